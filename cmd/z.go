@@ -3,16 +3,13 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"path"
-	"path/filepath"
-	"slices"
 	"strings"
 
 	"github.com/jessevdk/go-flags"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v3"
 
 	"z/internal/cfg"
 	"z/internal/cli"
@@ -40,59 +37,86 @@ func parseLogLevel(levelStr string) zerolog.Level {
 	}
 }
 
-func main() {
-	// Initialize logger with colored output by default
-	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
-
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		log.Fatal().Err(err).Msg("could not determine user home directory")
+// configFlag picks the value of --config out of the arguments, as it is
+// needed to read the config before they are parsed.
+func configFlag(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if value, ok := strings.CutPrefix(arg, "--config="); ok {
+			return value
+		}
+		if arg == "--config" && i+1 < len(args) {
+			return args[i+1]
+		}
 	}
-	configPath := path.Join(homeDir, ".config/z.yml")
-	configData, readErr := os.ReadFile(configPath)
-	if readErr != nil {
-		if os.IsNotExist(readErr) {
-			log.Warn().Str("path", configPath).Msg("config file not found, assuming no config (use 'z init' to set up)")
-		} else {
-			log.Warn().Err(readErr).Str("path", configPath).Msg("could not read config file, assuming no config")
+	return ""
+}
+
+// withoutConfigFlag returns the arguments without --config and its value, so
+// that the command and its arguments are at fixed positions.
+func withoutConfigFlag(args []string) []string {
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--":
+			return append(rest, args[i:]...)
+		case strings.HasPrefix(args[i], "--config="):
+		case args[i] == "--config":
+			i++
+		default:
+			rest = append(rest, args[i])
 		}
-	} else {
-		config := cfg.Cfg{}
-		err := yaml.Unmarshal(configData, &config)
-		if err != nil {
-			log.Fatal().Err(err).Str("path", configPath).Msg("could not parse config file - check YAML syntax")
-		} else {
-			cfg.GlobalCfg = config
-			for id, k := range cfg.GlobalCfg.Ks {
-				cfg.GlobalCfg.Ks[id] = cfg.K{
-					Path: os.ExpandEnv(k.Path),
-					URL:  os.ExpandEnv(k.URL),
-				}
-			}
+	}
+	return rest
+}
 
-			// Reconfigure logger based on settings
+// configureLogger sets up the logger according to the settings.
+func configureLogger(settings cfg.Settings) {
+	// Set log level (default: info)
+	logLevel := zerolog.InfoLevel
+	if settings.VerbosityLevel != "" {
+		logLevel = parseLogLevel(settings.VerbosityLevel)
+	}
+	zerolog.SetGlobalLevel(logLevel)
 
-			// Set log level (default: info)
-			logLevel := zerolog.InfoLevel
-			if cfg.GlobalCfg.Settings.VerbosityLevel != "" {
-				logLevel = parseLogLevel(cfg.GlobalCfg.Settings.VerbosityLevel)
-			}
-			zerolog.SetGlobalLevel(logLevel)
+	// Set color output
+	// If color is not explicitly set (nil), default to true (colored output)
+	// To disable colors, users must explicitly set color: false
+	colorEnabled := true // default
+	if settings.Color != nil {
+		colorEnabled = *settings.Color
+	}
+	if !colorEnabled {
+		// Disable colored output
+		log.Logger = log.Output(os.Stderr)
+	}
+}
 
-			// Set color output
-			// If color is not explicitly set (nil), default to true (colored output)
-			// To disable colors, users must explicitly set color: false
-			colorEnabled := true // default
-			if cfg.GlobalCfg.Settings.Color != nil {
-				colorEnabled = *cfg.GlobalCfg.Settings.Color
-			}
-			if !colorEnabled {
-				// Disable colored output
-				log.Logger = log.Output(os.Stderr)
-			}
+func main() {
+	// Initialize logger with colored output by default
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
-			log.Debug().Int("ks", len(cfg.GlobalCfg.Ks)).Int("blueprints", len(cfg.GlobalCfg.Blueprints)).Msg("loaded config")
+	configPath, err := cfg.Locate(configFlag(os.Args[1:]))
+	if err != nil {
+		log.Fatal().Err(err).Msg("could not determine config path")
+	}
+	config, loadErr := cfg.Load(configPath)
+	switch {
+	case errors.Is(loadErr, fs.ErrNotExist):
+		log.Warn().Str("path", configPath).Msg("config file not found, assuming no config (use 'z init' to set up)")
+		config, loadErr = &cfg.Cfg{Path: configPath}, nil
+	case loadErr != nil:
+		// fails the commands needing the config, but not 'config check'
+		config = &cfg.Cfg{Path: configPath}
+		loadErr = fmt.Errorf("could not load config file '%s' (%w)", configPath, loadErr)
+	default:
+		for _, problem := range config.Problems {
+			log.Warn().Str("problem", problem.String()).Msg("config problem (see 'z config check')")
 		}
+		configureLogger(config.Settings)
+		log.Debug().Int("ks", len(config.Ks)).Int("blueprints", len(config.Blueprints)).Msg("loaded config")
 	}
 
 	parser := flags.NewParser(&cli.Opts, flags.Default)
@@ -102,9 +126,13 @@ func main() {
 
 It provides commands for creating, finding, syncing, and managing notes across multiple knowledge bases.
 
-Configuration is read from ~/.config/z.yml which defines your Ks (knowledge bases) and blueprints.`
+Configuration is read from the file given by --config or $Z_CONFIG, or else from
+$XDG_CONFIG_HOME/z/z.yml or $XDG_CONFIG_HOME/z.yml ($XDG_CONFIG_HOME defaulting to
+~/.config). It defines your Ks (knowledge bases) and blueprints, may include further
+files and is overlaid by z.<hostname>.yml next to it, if that exists.`
 
 	parser.CompletionHandler = func(items []flags.Completion) {
+		args := withoutConfigFlag(os.Args)
 		suggestions := []string{}
 		if len(items) > 0 {
 			for _, item := range items {
@@ -112,99 +140,50 @@ Configuration is read from ~/.config/z.yml which defines your Ks (knowledge base
 					suggestions = append(suggestions, item.Item)
 				}
 			}
-		} else if len(os.Args) > 2 {
+		} else if len(args) > 2 {
 
-			switch os.Args[1] {
+			switch args[1] {
 
 			case "create":
-				switch len(os.Args) {
+				switch len(args) {
 				case 3: // complete K
-					for kID := range cfg.GlobalCfg.Ks {
+					for kID := range config.Ks {
 						suggestions = append(suggestions, kID)
 					}
 				case 5: // complete blueprint
-					for bID := range cfg.GlobalCfg.Blueprints {
+					for bID := range config.Blueprints {
 						suggestions = append(suggestions, bID)
 					}
 				}
 
 			case "open":
-				switch len(os.Args) {
+				switch len(args) {
 				case 3: // complete K
-					for kID := range cfg.GlobalCfg.Ks {
+					for kID := range config.Ks {
 						suggestions = append(suggestions, kID)
 					}
 				case 4: // complete file
 					// Get the K from the previous argument
-					kID := os.Args[2]
-					if k, ok := cfg.GlobalCfg.Ks[kID]; ok {
-						// Enumerate files in this K
-						entries, err := os.ReadDir(k.Path)
-						if err == nil {
-							for _, entry := range entries {
-								if entry.Name()[0] == '.' {
-									continue // skip hidden files
-								}
-								suggestions = append(suggestions, entry.Name())
-							}
-						}
+					kID := args[2]
+					if k, ok := config.Ks[kID]; ok {
+						// Enumerate the whole tree of this K
+						_ = cfg.WalkK(k.Path, config.Settings.MaxDepth, config.Ignore(k), true, func(rel, _ string) error {
+							suggestions = append(suggestions, rel)
+							return nil
+						})
 					}
 				case 5: // complete type
 					getTypes := func(file string, kid string) []string {
-						if k, ok := cfg.GlobalCfg.Ks[kid]; ok {
-							if path.IsAbs(file) {
-								if f, err := filepath.Rel(k.Path, file); err != nil {
-									// Given an abs path that's not relative to the K, nothing to tell here.
-									return []string{"Z", "D", "F", "S", "O"}
-								} else {
-									file = f
-								}
-							}
-							// Now we know file is relative to K path.
-
-							filePath := path.Join(k.Path, file)
-							if info, err := os.Stat(filePath); err == nil {
-								if info.IsDir() {
-									if zFileInfo, err := os.Stat(path.Join(filePath, ".z", "z.yml")); err == nil && !zFileInfo.IsDir() {
-										if yamlBytes, err := os.ReadFile(path.Join(filePath, ".z", "z.yml")); err == nil {
-											z := cfg.Z{}
-											if err := yaml.Unmarshal(yamlBytes, &z); err == nil {
-												return []string{"Z"}
-											}
-										}
-									}
-
-									return []string{"D"}
-								}
-
-								// If there is a dir element between K path and the ultimate file indicated:
-								if d := filepath.Dir(file); d != "." {
-									if info, err := os.Stat(path.Join(k.Path, d)); err != nil && info.IsDir() {
-										if zFileInfo, err := os.Stat(path.Join(k.Path, d, ".z", "z.yml")); err != nil && !zFileInfo.IsDir() {
-											if yamlBytes, err := os.ReadFile(path.Join(k.Path, d, ".z", "z.yml")); err != nil {
-												z := cfg.Z{}
-												if err := yaml.Unmarshal(yamlBytes, &z); err == nil {
-													if slices.Contains(z.Objects, filepath.Base(file)) {
-														return []string{"O"}
-													}
-													if slices.Contains(z.Sources, filepath.Base(file)) {
-														return []string{"S"}
-													}
-
-												}
-											}
-										}
-									}
-								} else {
-									return []string{"F"}
-								}
+						if k, ok := config.Ks[kid]; ok {
+							if zType, err := cfg.Classify(k.Path, file); err == nil {
+								return []string{zType}
 							}
 						}
 						return []string{"Z", "D", "F", "S", "O"}
 					}
 
-					file := os.Args[3]
-					kID := os.Args[2]
+					file := args[3]
+					kID := args[2]
 
 					types := getTypes(file, kID)
 					suggestions = append(suggestions, types...)
@@ -215,7 +194,7 @@ Configuration is read from ~/.config/z.yml which defines your Ks (knowledge base
 
 		}
 		for _, suggestion := range suggestions {
-			if strings.HasPrefix(suggestion, os.Args[len(os.Args)-1]) {
+			if strings.HasPrefix(suggestion, args[len(args)-1]) {
 				fmt.Println(suggestion)
 			}
 		}
@@ -223,6 +202,20 @@ Configuration is read from ~/.config/z.yml which defines your Ks (knowledge base
 	}
 	parser.SubcommandsOptional = false
 
+	// hand the commands their config before they run
+	parser.CommandHandler = func(command flags.Commander, args []string) error {
+		if command == nil {
+			return nil
+		}
+		if c, ok := command.(cli.Configurable); ok {
+			if _, checking := command.(*cli.ConfigCheckCommand); loadErr != nil && !checking {
+				return loadErr
+			}
+			c.SetConfig(config)
+		}
+		return command.Execute(args)
+	}
+
 	_, err = parser.Parse()
 	if err != nil {
 		if flags.WroteHelp(err) {
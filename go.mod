@@ -5,11 +5,11 @@ go 1.24
 require (
 	github.com/jessevdk/go-flags v1.5.0
 	github.com/rs/zerolog v1.27.0
+	golang.org/x/sys v0.0.0-20210927094055-39ccf1dd6fa6
 	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/mattn/go-colorable v0.1.12 // indirect
 	github.com/mattn/go-isatty v0.0.14 // indirect
-	golang.org/x/sys v0.0.0-20210927094055-39ccf1dd6fa6 // indirect
 )
@@ -1,39 +1,93 @@
-// Package cfg provides the global config, parsed by main.
+// Package cfg provides the config, see Load.
 package cfg
 
-// GlobalCfg is the global config, parsed by main.
-var GlobalCfg Cfg
+import (
+	"time"
+
+	"z/internal/ignore"
+
+	"gopkg.in/yaml.v3"
+)
 
 // Cfg is the top level config.
 type Cfg struct {
 	Settings   Settings             `yaml:"settings"`
 	Ks         map[string]K         `yaml:"Ks"`
 	Blueprints map[string]Blueprint `yaml:"blueprints"`
+	Openers    []Opener             `yaml:"openers,omitempty"`
+	Include    []string             `yaml:"include,omitempty"` // Further config files (globs, relative to this one) merged in beneath this one
+
+	Path     string    `yaml:"-"` // The file the config was loaded from
+	Problems []Problem `yaml:"-"` // What is wrong with the config, short of making it unusable
+
+	root *yaml.Node // the merged config, to locate problems
+	from origins
 }
 
 // Settings contains application-wide settings.
 type Settings struct {
-	Color          *bool  `yaml:"color"`           // Enable colored output in logs (default: true if nil)
-	VerbosityLevel string `yaml:"verbosity-level"` // Log level: trace, debug, info, warn, error, fatal, panic (default: info)
+	Color          *bool    `yaml:"color"`                               // Enable colored output in logs (default: true if nil)
+	VerbosityLevel string   `yaml:"verbosity-level"`                     // Log level: trace, debug, info, warn, error, fatal, panic (default: info)
+	SyncJobs       int      `yaml:"sync-jobs,omitempty"`                 // Number of Ks synced concurrently (default: 4)
+	CommitMessage  string   `yaml:"commit-message,omitempty" expand:"-"` // Template for sync commit messages (default: date and changed Z-notes)
+	DirOpener      string   `yaml:"dir-opener,omitempty" expand:"-"`     // Command template to open plain directories with, e.g. a file manager
+	MaxDepth       int      `yaml:"max-depth,omitempty"`                 // How many levels deep to look for files and Z-notes in Ks (default: unlimited)
+	Ignore         []string `yaml:"ignore,omitempty" expand:"-"`         // Patterns of paths to ignore in all Ks, in addition to .gitignore and .zignore files
+	Daemon         Daemon   `yaml:"daemon,omitempty"`
+}
+
+// Daemon configures the background sync daemon.
+type Daemon struct {
+	QuietPeriod  time.Duration `yaml:"quiet-period,omitempty"`  // How long a K must be unchanged before committing (default: 30s)
+	SyncInterval time.Duration `yaml:"sync-interval,omitempty"` // How often Ks are synced with their remotes (default: 10m, negative disables)
+}
+
+// Ignore returns the matcher for the paths ignored in a K.
+func (c *Cfg) Ignore(k K) *ignore.Matcher {
+	return ignore.New(k.Path, c.Settings.Ignore)
 }
 
 // A K is a single 'Kasten', a directory of Zs (files).
 type K struct {
-	Path string `yaml:"path"` // when empty, sync will be assumed to be manual
-	URL  string `yaml:"url"`
+	Path string     `yaml:"path"` // when empty, sync will be assumed to be manual
+	URL  string     `yaml:"url"`
+	Sync SyncPolicy `yaml:"sync,omitempty"`
+}
+
+// SyncPolicy configures how a K is synced.
+type SyncPolicy struct {
+	AutoCommit *bool  `yaml:"auto-commit,omitempty"` // Commit local changes when syncing (default: true if nil)
+	Remote     string `yaml:"remote,omitempty"`      // Remote to sync with (default: the current branch's upstream)
+	Branch     string `yaml:"branch,omitempty"`      // Remote branch to sync with (default: the current branch's upstream)
+	Strategy   string `yaml:"strategy,omitempty"`    // How to pull: rebase (default) or merge
+	Conflicts  string `yaml:"conflicts,omitempty"`   // On conflicts when pulling: stop (default, resolve manually) or keep-both
 }
 
 // A Blueprint is a template for a new Z (file).
 type Blueprint struct {
 	Subdir    string            `yaml:"subdir"`
-	Templates map[string]string `yaml:"templates"`
-	Open      string            `yaml:"open"`
-	View      string            `yaml:"view"`
-	Post      []string          `yaml:"post"`
+	Templates map[string]string `yaml:"templates" expand:"-"`
+	Open      string            `yaml:"open" expand:"-"`
+	View      string            `yaml:"view" expand:"-"`
+	Post      []string          `yaml:"post" expand:"-"`
 	Sources   []string          `yaml:"sources"`
 	Objects   []string          `yaml:"objects"`
 }
 
+// An Opener opens and previews the files it matches. Files are matched by
+// extension, by glob, by MIME type or by the class their content is sniffed
+// as; the first matching opener wins.
+type Opener struct {
+	Extensions []string `yaml:"extensions"` // e.g. [md, txt], without the dot
+	Globs      []string `yaml:"globs"`      // matched against the file name, or the path if they contain a '/'
+	MIME       []string `yaml:"mime"`       // e.g. [image/png, "text/*"]
+	Classes    []string `yaml:"classes"`    // any of text, image, pdf, html, archive, binary
+	Open       string   `yaml:"open"`       // command template to open with, run with bash
+	Preview    string   `yaml:"preview"`    // command template to print a preview to the terminal with
+	Detach     bool     `yaml:"detach"`     // run the open command in the background instead of waiting for it
+	Batch      bool     `yaml:"batch"`      // the open command takes several files at once, as .Paths
+}
+
 // TemplateFiller is the data passed to templates.
 type TemplateFiller struct {
 	K     K
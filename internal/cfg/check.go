@@ -0,0 +1,324 @@
+package cfg
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A Problem is something wrong with the config, at a position in a file.
+type Problem struct {
+	File    string
+	Line    int // 0 if unknown
+	Column  int // 0 if unknown
+	Message string
+}
+
+func (p Problem) String() string {
+	switch {
+	case p.Line == 0:
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	case p.Column == 0:
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	default:
+		return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, p.Message)
+	}
+}
+
+// Error makes a Problem usable as an error, for problems that make the whole
+// file unusable.
+func (p *Problem) Error() string { return p.String() }
+
+// yamlLine extracts the line from the messages of the yaml package.
+var yamlLine = regexp.MustCompile(`line (\d+): `)
+
+// problemOf turns a message of the yaml package into a problem.
+func problemOf(file, msg string) Problem {
+	msg = strings.TrimPrefix(msg, "yaml: ")
+	p := Problem{File: file, Message: msg}
+	if m := yamlLine.FindStringSubmatchIndex(msg); m != nil {
+		p.Line, _ = strconv.Atoi(msg[m[2]:m[3]])
+		p.Message = msg[:m[0]] + msg[m[1]:]
+	}
+	return p
+}
+
+// origins maps the nodes of a config to the file they were read from, as
+// the config may be merged from several files.
+type origins map[*yaml.Node]string
+
+// record notes file as the origin of node and everything below it.
+func (o origins) record(file string, node *yaml.Node) {
+	if node == nil {
+		return
+	}
+	o[node] = file
+	for _, n := range node.Content {
+		o.record(file, n)
+	}
+}
+
+// at returns the problem with msg at the position of node, in the file the
+// node was read from, falling back to file.
+func (o origins) at(file string, node *yaml.Node, msg string) Problem {
+	p := Problem{File: file, Message: msg}
+	if node == nil {
+		return p
+	}
+	if f, ok := o[node]; ok {
+		p.File = f
+	}
+	p.Line, p.Column = node.Line, node.Column
+	return p
+}
+
+// checkKnown reports the keys of mappings that do not correspond to a field
+// of the struct they are decoded into.
+func checkKnown(file string, from origins, node *yaml.Node, t reflect.Type, at string, problems *[]Problem) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			checkKnown(file, from, n, t, at, problems)
+		}
+		return
+	case yaml.AliasNode:
+		checkKnown(file, from, node.Alias, t, at, problems)
+		return
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := map[string]reflect.Type{}
+		names := []string{}
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "" || name == "-" || !f.IsExported() {
+				continue
+			}
+			fields[name] = f.Type
+			names = append(names, name)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			ft, ok := fields[key.Value]
+			if !ok {
+				msg := fmt.Sprintf("unknown key '%s'", key.Value)
+				if at != "" {
+					msg += fmt.Sprintf(" in '%s'", at)
+				}
+				if suggestion := closest(key.Value, names); suggestion != "" {
+					msg += fmt.Sprintf(" (did you mean '%s'?)", suggestion)
+				}
+				*problems = append(*problems, from.at(file, key, msg))
+				continue
+			}
+			checkKnown(file, from, value, ft, join(at, key.Value), problems)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkKnown(file, from, node.Content[i+1], t.Elem(), join(at, node.Content[i].Value), problems)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, n := range node.Content {
+			checkKnown(file, from, n, t.Elem(), join(at, strconv.Itoa(i)), problems)
+		}
+	}
+}
+
+func join(at, key string) string {
+	if at == "" {
+		return key
+	}
+	return at + "." + key
+}
+
+// closest suggests the name a misspelled key was likely meant to be.
+func closest(key string, names []string) string {
+	best, bestDist := "", 3
+	for _, name := range names {
+		if strings.EqualFold(key, name) {
+			return name
+		}
+		if d := distance(strings.ToLower(key), name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// distance is the Levenshtein distance between two strings.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// validate reports the problems of a decoded config that the types alone do
+// not catch, at the position of the offending node in root (if root is
+// given).
+func validate(file string, from origins, c *Cfg, root *yaml.Node) []Problem {
+	problems := []Problem{}
+	report := func(msg string, keys ...string) {
+		problems = append(problems, from.at(file, lookup(root, keys...), msg))
+	}
+	checkTemplate := func(funcs template.FuncMap, t string, keys ...string) {
+		if t == "" {
+			return
+		}
+		if _, err := template.New("").Funcs(funcs).Parse(t); err != nil {
+			report(fmt.Sprintf("invalid template (%s)", strings.TrimPrefix(err.Error(), "template: :")), keys...)
+		}
+	}
+
+	s := c.Settings
+	levels := []string{"", "trace", "debug", "info", "warn", "warning", "error", "fatal", "panic"}
+	if !slices.Contains(levels, strings.ToLower(s.VerbosityLevel)) {
+		report(fmt.Sprintf("unknown verbosity level '%s'", s.VerbosityLevel), "settings", "verbosity-level")
+	}
+	if s.SyncJobs < 0 {
+		report("sync-jobs must not be negative", "settings", "sync-jobs")
+	}
+	if s.Daemon.QuietPeriod < 0 {
+		report("quiet-period must not be negative", "settings", "daemon", "quiet-period")
+	}
+	checkTemplate(CommitMessageFuncs, s.CommitMessage, "settings", "commit-message")
+	checkTemplate(CommandFuncs, s.DirOpener, "settings", "dir-opener")
+	if s.MaxDepth < 0 {
+		report("max-depth must not be negative", "settings", "max-depth")
+	}
+
+	for _, id := range sortedKeys(c.Ks) {
+		k := c.Ks[id]
+		if k.Path == "" {
+			report(fmt.Sprintf("K '%s' has no path", id), "Ks", id)
+		}
+		if !slices.Contains([]string{"", "rebase", "merge"}, k.Sync.Strategy) {
+			report(fmt.Sprintf("unknown sync strategy '%s' (expected 'rebase' or 'merge')", k.Sync.Strategy), "Ks", id, "sync", "strategy")
+		}
+		if !slices.Contains([]string{"", "stop", "keep-both"}, k.Sync.Conflicts) {
+			report(fmt.Sprintf("unknown conflict strategy '%s' (expected 'stop' or 'keep-both')", k.Sync.Conflicts), "Ks", id, "sync", "conflicts")
+		}
+	}
+
+	for _, id := range sortedKeys(c.Blueprints) {
+		b := c.Blueprints[id]
+		if b.Open == "" {
+			report(fmt.Sprintf("blueprint '%s' is missing the required 'open' command", id), "blueprints", id)
+		}
+		if b.Subdir == "" {
+			if len(b.Templates) != 1 {
+				report(fmt.Sprintf("blueprint '%s' has no subdir, so it must have exactly one template", id), "blueprints", id)
+			}
+			if len(b.Post) > 0 {
+				report(fmt.Sprintf("blueprint '%s' has no subdir, so it cannot have post hooks", id), "blueprints", id, "post")
+			}
+		}
+		checkTemplate(BlueprintFuncs, b.Subdir, "blueprints", id, "subdir")
+		checkTemplate(BlueprintFuncs, b.Open, "blueprints", id, "open")
+		checkTemplate(BlueprintFuncs, b.View, "blueprints", id, "view")
+		for _, name := range sortedKeys(b.Templates) {
+			checkTemplate(BlueprintFuncs, name, "blueprints", id, "templates", name)
+			checkTemplate(BlueprintFuncs, b.Templates[name], "blueprints", id, "templates", name)
+		}
+		for i, t := range b.Post {
+			checkTemplate(BlueprintFuncs, t, "blueprints", id, "post", strconv.Itoa(i))
+		}
+		for i, t := range b.Sources {
+			checkTemplate(BlueprintFuncs, t, "blueprints", id, "sources", strconv.Itoa(i))
+		}
+		for i, t := range b.Objects {
+			checkTemplate(BlueprintFuncs, t, "blueprints", id, "objects", strconv.Itoa(i))
+		}
+	}
+
+	classes := []string{"text", "image", "pdf", "html", "archive", "binary"}
+	for i, o := range c.Openers {
+		at := strconv.Itoa(i)
+		if len(o.Extensions)+len(o.Globs)+len(o.MIME)+len(o.Classes) == 0 {
+			report(fmt.Sprintf("opener %d matches nothing (set extensions, globs, mime or classes)", i), "openers", at)
+		}
+		if o.Open == "" && o.Preview == "" {
+			report(fmt.Sprintf("opener %d has neither an open nor a preview command", i), "openers", at)
+		}
+		for _, class := range o.Classes {
+			if !slices.Contains(classes, class) {
+				report(fmt.Sprintf("unknown class '%s' (expected one of %s)", class, strings.Join(classes, ", ")), "openers", at, "classes")
+			}
+		}
+		checkTemplate(CommandFuncs, o.Open, "openers", at, "open")
+		checkTemplate(CommandFuncs, o.Preview, "openers", at, "preview")
+	}
+
+	return problems
+}
+
+// lookup finds the node at the path of keys (or sequence indices) in root,
+// or the closest one found on the way.
+func lookup(root *yaml.Node, keys ...string) *yaml.Node {
+	if root == nil {
+		return nil
+	}
+	n := root
+	if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	found := n
+	for _, key := range keys {
+		var next *yaml.Node
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == key {
+					found, next = n.Content[i], n.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(n.Content) {
+				found, next = n.Content[i], n.Content[i]
+			}
+		}
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	if n.Kind == yaml.ScalarNode {
+		// point at the value itself
+		return n
+	}
+	return found
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
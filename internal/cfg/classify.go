@@ -0,0 +1,102 @@
+package cfg
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Classify resolves a path inside a K to its Z-type: Z for a Z-note, D for a
+// plain directory, S and O for a source or object of the closest Z-note
+// containing it, and F for any other file. The path may be absolute or
+// relative to the K's path.
+func Classify(kPath, file string) (string, error) {
+	if path.IsAbs(file) {
+		rel, err := filepath.Rel(kPath, file)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return "", fmt.Errorf("'%s' is not inside '%s'", file, kPath)
+		}
+		file = rel
+	}
+	file = path.Clean(file)
+	fullPath := path.Join(kPath, file)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		if IsNote(fullPath) {
+			return "Z", nil
+		}
+		return "D", nil
+	}
+
+	// the closest note up to the K's root decides
+	if dir, ok := NoteOf(kPath, path.Dir(file)); ok {
+		z, err := ReadZ(path.Join(kPath, dir))
+		if err != nil {
+			return "", fmt.Errorf("unable to read Z-note '%s' (%s)", dir, err.Error())
+		}
+		inNote := strings.TrimPrefix(file, dir+"/")
+		if slices.ContainsFunc(z.Sources, func(s string) bool { return path.Clean(s) == inNote }) {
+			return "S", nil
+		}
+		if slices.ContainsFunc(z.Objects, func(o string) bool { return path.Clean(o) == inNote }) {
+			return "O", nil
+		}
+	}
+	return "F", nil
+}
+
+// NoteOf finds the closest Z-note containing a path relative to a K's path,
+// including the path itself, and returns its path relative to the K.
+func NoteOf(kPath, rel string) (string, bool) {
+	for dir := path.Clean(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if IsNote(path.Join(kPath, dir)) {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// KOf finds the K a path belongs to and returns its ID and the path relative
+// to it. Symlinks are resolved and of nested Ks, the innermost one wins.
+func (c *Cfg) KOf(file string) (string, string, error) {
+	real, err := realPath(file)
+	if err != nil {
+		return "", "", err
+	}
+	kID, rel, longest := "", "", -1
+	for id, k := range c.Ks {
+		kPath, err := realPath(k.Path)
+		if err != nil || len(kPath) <= longest {
+			continue
+		}
+		if r, err := filepath.Rel(kPath, real); err == nil && r != ".." && !strings.HasPrefix(r, "../") {
+			kID, rel, longest = id, r, len(kPath)
+		}
+	}
+	if kID == "" {
+		return "", "", fmt.Errorf("'%s' is not in any K", file)
+	}
+	return kID, rel, nil
+}
+
+// realPath makes a path absolute and resolves symlinks, as far as it exists.
+func realPath(file string) (string, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real, nil
+	}
+	// the file may be gone, like one just removed, but its directory not
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(dir, filepath.Base(abs)), nil
+	}
+	return abs, nil
+}
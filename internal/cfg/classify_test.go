@@ -0,0 +1,145 @@
+package cfg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// makeK creates files in a fresh K, a path ending in '/' being a dir, and
+// the given Z-notes in it.
+func makeK(t *testing.T, files []string, notes map[string]Z) string {
+	t.Helper()
+	k := t.TempDir()
+	for _, f := range files {
+		p := filepath.Join(k, f)
+		if f[len(f)-1] == '/' {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for dir, z := range notes {
+		if err := WriteZ(filepath.Join(k, dir), z); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return k
+}
+
+func TestClassify(t *testing.T) {
+	k := makeK(t,
+		[]string{"loose.md", "plain/", "plain/file.md", "note/main.tex", "note/main.pdf", "note/sub/fig.png", "note/other.md", "note/inner/x.md"},
+		map[string]Z{
+			"note":       {Sources: []string{"main.tex", "./sub/fig.png"}, Objects: []string{"main.pdf"}},
+			"note/inner": {},
+		},
+	)
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"loose.md", "F"},
+		{"plain", "D"},
+		{"plain/file.md", "F"},
+		{"note", "Z"},
+		{"note/", "Z"},
+		{"note/main.tex", "S"},
+		{"note/sub/fig.png", "S"},
+		{"note/main.pdf", "O"},
+		{"note/other.md", "F"},
+		{"note/inner", "Z"},
+		// the closest Z-note decides, even if it doesn't list the file
+		{"note/inner/x.md", "F"},
+		{filepath.Join(k, "note", "main.tex"), "S"},
+	}
+	for _, tt := range tests {
+		got, err := Classify(k, tt.file)
+		if err != nil {
+			t.Errorf("Classify(%q) failed (%s)", tt.file, err.Error())
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Classify(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+
+	for _, file := range []string{"missing.md", filepath.Dir(k), filepath.Join(filepath.Dir(k), "elsewhere.md")} {
+		if got, err := Classify(k, file); err == nil {
+			t.Errorf("Classify(%q) = %q, want an error", file, got)
+		}
+	}
+}
+
+func TestNoteOf(t *testing.T) {
+	k := makeK(t, []string{"loose.md", "note/sub/a.md", "note/inner/b.md"}, map[string]Z{"note": {}, "note/inner": {}})
+	tests := []struct {
+		rel    string
+		want   string
+		wantOk bool
+	}{
+		{"note/sub/a.md", "note", true},
+		{"note/inner/b.md", "note/inner", true},
+		{"note/inner", "note/inner", true},
+		{"note", "note", true},
+		{"loose.md", "", false},
+		{".", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := NoteOf(k, tt.rel); got != tt.want || ok != tt.wantOk {
+			t.Errorf("NoteOf(%q) = %q, %v, want %q, %v", tt.rel, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestKOf(t *testing.T) {
+	outer := makeK(t, []string{"a.md", "nested/b.md", "other/c.md"}, nil)
+	dir := t.TempDir()
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(filepath.Join(outer, "other"), link); err != nil {
+		t.Skip("unable to create symlinks")
+	}
+	c := &Cfg{Ks: map[string]K{
+		"outer":  {Path: outer},
+		"nested": {Path: filepath.Join(outer, "nested")},
+		"linked": {Path: link},
+	}}
+	tests := []struct {
+		file string
+		kID  string
+		rel  string
+	}{
+		{filepath.Join(outer, "a.md"), "outer", "a.md"},
+		{outer, "outer", "."},
+		// of nested Ks, the innermost one wins
+		{filepath.Join(outer, "nested", "b.md"), "nested", "b.md"},
+		// symlinks are resolved, both of the K and of the path
+		{filepath.Join(outer, "other", "c.md"), "linked", "c.md"},
+		{filepath.Join(link, "c.md"), "linked", "c.md"},
+		// paths that don't exist (anymore) are found through their dir
+		{filepath.Join(link, "gone.md"), "linked", "gone.md"},
+	}
+	for _, tt := range tests {
+		kID, rel, err := c.KOf(tt.file)
+		if err != nil {
+			t.Errorf("KOf(%q) failed (%s)", tt.file, err.Error())
+			continue
+		}
+		if kID != tt.kID || rel != tt.rel {
+			t.Errorf("KOf(%q) = %q, %q, want %q, %q", tt.file, kID, rel, tt.kID, tt.rel)
+		}
+	}
+
+	for _, file := range []string{dir, filepath.Dir(outer), outer + "-sibling"} {
+		if kID, _, err := c.KOf(file); err == nil {
+			t.Errorf("KOf(%q) = %q, want an error", file, kID)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package cfg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// An Editor changes a config file through its yaml nodes, so that the
+// comments and the order of keys in it are kept. Only the file itself is
+// edited, not the files it includes or its overlay.
+type Editor struct {
+	file   string
+	doc    *yaml.Node
+	before []Problem
+}
+
+// Edit reads the config file for editing. A missing or empty file is edited
+// as an empty config.
+func Edit(file string) (*Editor, error) {
+	e := &Editor{file: file}
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not read config file (%s)", err.Error())
+	}
+	doc := &yaml.Node{}
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(doc); err != nil {
+		if !errors.Is(err, io.EOF) {
+			p := problemOf(file, err.Error())
+			return nil, &p
+		}
+		doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, &Problem{File: file, Message: "config is not a mapping"}
+	}
+	e.doc = doc
+	e.before = problemsOf(file, e.root())
+	return e, nil
+}
+
+func (e *Editor) root() *yaml.Node { return e.doc.Content[0] }
+
+// Get returns the node at the path of keys, if it is in the file.
+func (e *Editor) Get(keys ...string) (*yaml.Node, bool) {
+	n := e.root()
+	for _, key := range keys {
+		if n = valueOf(n, key); n == nil {
+			return nil, false
+		}
+	}
+	return n, true
+}
+
+// Set puts value at the path of keys, creating the mappings on the way. The
+// comments of a value that is replaced are kept.
+func (e *Editor) Set(value *yaml.Node, keys ...string) {
+	// the value is not in the file yet, so its positions mean nothing there
+	unplace(value)
+	n := e.root()
+	for i, key := range keys {
+		if n.Kind != yaml.MappingNode {
+			// a plain value where a mapping belongs is replaced by one
+			*n = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		next := valueOf(n, key)
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, next)
+		}
+		if i == len(keys)-1 {
+			head, line, foot := next.HeadComment, next.LineComment, next.FootComment
+			*next = *value
+			next.HeadComment, next.LineComment, next.FootComment = head, line, foot
+		}
+		n = next
+	}
+}
+
+// Delete removes the key at the end of the path of keys, telling whether it
+// was there.
+func (e *Editor) Delete(keys ...string) bool {
+	if len(keys) == 0 {
+		return false
+	}
+	parent, ok := e.Get(keys[:len(keys)-1]...)
+	if !ok || parent.Kind != yaml.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == keys[len(keys)-1] {
+			parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Save writes the config file, unless the edits introduced problems, which
+// are returned as the error instead.
+func (e *Editor) Save() error {
+	introduced := []error{}
+	for _, p := range problemsOf(e.file, e.root()) {
+		if !e.hadProblem(p) {
+			introduced = append(introduced, &p)
+		}
+	}
+	if len(introduced) > 0 {
+		return errors.Join(introduced...)
+	}
+
+	b := bytes.Buffer{}
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(2)
+	if err := enc.Encode(e.doc); err != nil {
+		return fmt.Errorf("unable to marshal config (%s)", err.Error())
+	}
+	if err := enc.Close(); err != nil {
+		return fmt.Errorf("unable to marshal config (%s)", err.Error())
+	}
+	// a config that is a symlink, e.g. into a dotfile repository, stays one
+	file, mode := e.file, os.FileMode(0644)
+	if target, err := filepath.EvalSymlinks(e.file); err == nil {
+		file = target
+		if info, err := os.Stat(file); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("could not create config directory (%s)", err.Error())
+	}
+	// write next to the file and move it in place, to never leave half of it
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), mode); err != nil {
+		return fmt.Errorf("could not write config file (%s)", err.Error())
+	}
+	// the umask applies on creation, but the mode is to be kept as it was
+	if err := os.Chmod(tmp, mode); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("could not write config file (%s)", err.Error())
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("could not write config file (%s)", err.Error())
+	}
+	return nil
+}
+
+// hadProblem tells whether the file had a problem before it was edited. Lines
+// may have moved, so only the messages are compared.
+func (e *Editor) hadProblem(p Problem) bool {
+	for _, before := range e.before {
+		if before.Message == p.Message {
+			return true
+		}
+	}
+	return false
+}
+
+// problemsOf reports the problems of the config in root, read from file,
+// as Read would for the file alone.
+func problemsOf(file string, root *yaml.Node) []Problem {
+	from := origins{}
+	from.record(file, root)
+	problems := []Problem{}
+	c := Cfg{}
+	if err := root.Decode(&c); err != nil {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			for _, msg := range typeErr.Errors {
+				problems = append(problems, problemOf(file, msg))
+			}
+		} else {
+			problems = append(problems, problemOf(file, err.Error()))
+		}
+	}
+	checkKnown(file, from, root, reflect.TypeOf(c), "", &problems)
+	return append(problems, validate(file, from, &c, root)...)
+}
+
+func unplace(n *yaml.Node) {
+	n.Line, n.Column = 0, 0
+	for _, c := range n.Content {
+		unplace(c)
+	}
+}
+
+// valueOf returns the value of key in the mapping n, or nil.
+func valueOf(n *yaml.Node, key string) *yaml.Node {
+	if n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
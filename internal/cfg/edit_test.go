@@ -0,0 +1,151 @@
+package cfg
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const editBefore = `# my config
+settings:
+  sync-jobs: 2 # not too many
+Ks:
+  notes:
+    path: /home/u/notes
+  work:
+    path: /home/u/work
+`
+
+func TestEditorSetDelete(t *testing.T) {
+	scalar := func(v string) *yaml.Node { return &yaml.Node{Kind: yaml.ScalarNode, Value: v} }
+	tests := []struct {
+		name string
+		edit func(e *Editor) bool
+		want string
+	}{
+		{
+			name: "replace keeps the comment",
+			edit: func(e *Editor) bool { e.Set(scalar("8"), "settings", "sync-jobs"); return true },
+			want: strings.Replace(editBefore, "sync-jobs: 2", "sync-jobs: 8", 1),
+		},
+		{
+			name: "add creates the mappings",
+			edit: func(e *Editor) bool { e.Set(scalar("30s"), "settings", "daemon", "quiet-period"); return true },
+			want: strings.Replace(editBefore, "# not too many\n", "# not too many\n  daemon:\n    quiet-period: 30s\n", 1),
+		},
+		{
+			name: "add a K",
+			edit: func(e *Editor) bool {
+				k := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{scalar("path"), scalar("/tmp/k")}}
+				e.Set(k, "Ks", "new")
+				return true
+			},
+			want: editBefore + "  new:\n    path: /tmp/k\n",
+		},
+		{
+			name: "delete",
+			edit: func(e *Editor) bool { return e.Delete("Ks", "notes") },
+			want: strings.Replace(editBefore, "  notes:\n    path: /home/u/notes\n", "", 1),
+		},
+		{
+			name: "delete a missing key",
+			edit: func(e *Editor) bool { return !e.Delete("Ks", "missing") && !e.Delete("nothing", "here") && !e.Delete() },
+			want: editBefore,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := path.Join(t.TempDir(), "z.yml")
+			if err := os.WriteFile(file, []byte(editBefore), 0644); err != nil {
+				t.Fatal(err)
+			}
+			e, err := Edit(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.edit(e) {
+				t.Fatal("unexpected result of the edit")
+			}
+			if err := e.Save(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("saved\n%s\nwant\n%s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditorSave(t *testing.T) {
+	dir := t.TempDir()
+	target := path.Join(dir, "dotfiles", "z.yml")
+	link := path.Join(dir, "z.yml")
+	if err := os.MkdirAll(path.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte(editBefore), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := Edit(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Set(&yaml.Node{Kind: yaml.ScalarNode, Value: "many"}, "settings", "sync-jobs")
+	if err := e.Save(); err == nil {
+		t.Error("saving a config with a new problem should fail")
+	}
+	if data, _ := os.ReadFile(target); string(data) != editBefore {
+		t.Errorf("a failed save changed the file to\n%s", data)
+	}
+
+	e.Set(&yaml.Node{Kind: yaml.ScalarNode, Value: "3"}, "settings", "sync-jobs")
+	if err := e.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("the config is no longer a symlink (%v)", err)
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("the mode changed to %v", info.Mode().Perm())
+	}
+	if c, _, err := Read(link); err != nil || c.Settings.SyncJobs != 3 {
+		t.Errorf("read back sync-jobs %d (%v), want 3", c.Settings.SyncJobs, err)
+	}
+}
+
+func TestEditMissing(t *testing.T) {
+	file := path.Join(t.TempDir(), "sub", "z.yml")
+	e, err := Edit(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.Get("settings"); ok {
+		t.Error("a missing file should be edited as an empty config")
+	}
+	e.Set(&yaml.Node{Kind: yaml.ScalarNode, Value: "debug"}, "settings", "verbosity-level")
+	if err := e.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "settings:\n  verbosity-level: debug\n"; string(data) != want {
+		t.Errorf("saved %q, want %q", data, want)
+	}
+}
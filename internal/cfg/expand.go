@@ -0,0 +1,113 @@
+package cfg
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Expand expands every string in the Ks, blueprints and settings, as
+// ExpandString does, except in the fields tagged `expand:"-"`: commands and
+// templates are left to the shell that runs them, and ignore patterns are no
+// paths. Every reference to an undefined variable is reported as a problem.
+func (c *Cfg) Expand() []Problem {
+	problems := []Problem{}
+	for _, id := range sortedKeys(c.Ks) {
+		k := c.Ks[id]
+		c.expandFields(reflect.ValueOf(&k).Elem(), []string{"Ks", id}, &problems)
+		c.Ks[id] = k
+	}
+	for _, id := range sortedKeys(c.Blueprints) {
+		b := c.Blueprints[id]
+		c.expandFields(reflect.ValueOf(&b).Elem(), []string{"blueprints", id}, &problems)
+		c.Blueprints[id] = b
+	}
+	c.expandFields(reflect.ValueOf(&c.Settings).Elem(), []string{"settings"}, &problems)
+	return problems
+}
+
+// expandFields expands the strings in the fields of the struct v, and in
+// those of the structs, lists and maps in it, at the path of keys in the
+// config.
+func (c *Cfg) expandFields(v reflect.Value, at []string, problems *[]Problem) {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" || !f.IsExported() || f.Tag.Get("expand") == "-" {
+			continue
+		}
+		c.expandValue(v.Field(i), append(slices.Clone(at), name), problems)
+	}
+}
+
+// expandValue expands the strings in v, at the path of keys in the config.
+func (c *Cfg) expandValue(v reflect.Value, keys []string, problems *[]Problem) {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := ExpandString(v.String())
+		if err != nil {
+			msg := fmt.Sprintf("%s (in '%s')", err.Error(), strings.Join(keys, "."))
+			*problems = append(*problems, c.from.at(c.Path, lookup(c.root, keys...), msg))
+			return
+		}
+		v.SetString(s)
+	case reflect.Struct:
+		c.expandFields(v, keys, problems)
+	case reflect.Slice:
+		for j := range v.Len() {
+			c.expandValue(v.Index(j), append(slices.Clone(keys), strconv.Itoa(j)), problems)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return
+		}
+		for _, key := range v.MapKeys() {
+			// map values cannot be set in place
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			c.expandValue(value, append(slices.Clone(keys), key.String()), problems)
+			v.SetMapIndex(key, value)
+		}
+	}
+}
+
+// ExpandString expands a leading ~ to the home directory, and $VAR, ${VAR}
+// and ${VAR:-default} to the values of environment variables, the default
+// being used if the variable is unset or empty. $$ is a literal $.
+// Referencing an undefined variable without a default is an error.
+func ExpandString(s string) (string, error) {
+	if s == "~" || strings.HasPrefix(s, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine user home directory (%w)", err)
+		}
+		s = homeDir + s[1:]
+	}
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	undefined := []string{}
+	expanded := os.Expand(s, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+		name, fallback, hasFallback := strings.Cut(name, ":-")
+		value, ok := os.LookupEnv(name)
+		switch {
+		case hasFallback && value == "":
+			return fallback
+		case !ok:
+			undefined = append(undefined, name)
+		}
+		return value
+	})
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("undefined variable '%s'", strings.Join(undefined, "', '"))
+	}
+	return expanded, nil
+}
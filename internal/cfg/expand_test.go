@@ -0,0 +1,107 @@
+package cfg
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestExpandString(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	t.Setenv("Z_TEST_SET", "value")
+	t.Setenv("Z_TEST_EMPTY", "")
+	_ = os.Unsetenv("Z_TEST_UNSET")
+
+	tests := []struct {
+		s    string
+		want string
+		err  string
+	}{
+		{s: "plain", want: "plain"},
+		{s: "~", want: home},
+		{s: "~/notes", want: home + "/notes"},
+		{s: "~user/notes", want: "~user/notes"},
+		{s: "a/~/b", want: "a/~/b"},
+		{s: "$Z_TEST_SET/x", want: "value/x"},
+		{s: "${Z_TEST_SET}x", want: "valuex"},
+		{s: "$Z_TEST_EMPTY", want: ""},
+		{s: "${Z_TEST_UNSET:-default}", want: "default"},
+		{s: "${Z_TEST_EMPTY:-default}", want: "default"},
+		{s: "${Z_TEST_SET:-default}", want: "value"},
+		{s: "$$Z_TEST_SET", want: "$Z_TEST_SET"},
+		{s: "~/$Z_TEST_SET", want: home + "/value"},
+		{s: "$Z_TEST_UNSET", err: "undefined variable 'Z_TEST_UNSET'"},
+		{s: "${Z_TEST_UNSET}/$Z_TEST_UNSET2", err: "undefined variable 'Z_TEST_UNSET', 'Z_TEST_UNSET2'"},
+	}
+	for _, tt := range tests {
+		got, err := ExpandString(tt.s)
+		switch {
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("ExpandString(%q) error = %v, want %q", tt.s, err, tt.err)
+		case tt.err == "" && err != nil:
+			t.Errorf("ExpandString(%q) error = %v", tt.s, err)
+		case tt.err == "" && got != tt.want:
+			t.Errorf("ExpandString(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	t.Setenv("Z_TEST_DIR", "/data")
+	_ = os.Unsetenv("Z_TEST_UNSET")
+	file := path.Join(t.TempDir(), "z.yml")
+	config := `Ks:
+  notes:
+    path: $Z_TEST_DIR/notes
+    url: ${Z_TEST_URL:-git@example.com:notes.git}
+    sync:
+      branch: ${Z_TEST_BRANCH:-main}
+  broken:
+    path: $Z_TEST_UNSET/broken
+blueprints:
+  note:
+    subdir: $Z_TEST_DIR/sub
+    templates:
+      note.md: "# $Z_TEST_DIR"
+    open: nvim "$Z_TEST_UNSET"
+    post: ["echo $HOME"]
+    sources: ["$Z_TEST_DIR/src"]
+settings:
+  commit-message: "$Z_TEST_UNSET {{.Subject}}"
+  ignore: ["$Z_TEST_DIR", "~/x"]
+`
+	if err := os.WriteFile(file, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, problems, err := Read(file)
+	if err != nil || len(problems) > 0 {
+		t.Fatalf("Read() = %v, %v", problems, err)
+	}
+	problems = c.Expand()
+
+	if len(problems) != 1 || problems[0].Line != 8 || !strings.Contains(problems[0].Message, "'Z_TEST_UNSET' (in 'Ks.broken.path')") {
+		t.Errorf("Expand() = %v, want one problem with Ks.broken.path at line 8", problems)
+	}
+	k, b := c.Ks["notes"], c.Blueprints["note"]
+	for _, tt := range []struct{ got, want string }{
+		{k.Path, "/data/notes"},
+		{k.URL, "git@example.com:notes.git"},
+		{k.Sync.Branch, "main"},
+		{b.Subdir, "/data/sub"},
+		{b.Sources[0], "/data/src"},
+		{b.Templates["note.md"], "# $Z_TEST_DIR"},
+		{b.Open, `nvim "$Z_TEST_UNSET"`},
+		{b.Post[0], "echo $HOME"},
+		{c.Settings.CommitMessage, "$Z_TEST_UNSET {{.Subject}}"},
+		{c.Settings.Ignore[0], "$Z_TEST_DIR"},
+		{c.Settings.Ignore[1], "~/x"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("expanded to %q, want %q", tt.got, tt.want)
+		}
+	}
+}
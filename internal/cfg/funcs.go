@@ -0,0 +1,23 @@
+package cfg
+
+import (
+	"strings"
+	"text/template"
+)
+
+// The functions available in each kind of template, used both to run the
+// templates and to check them.
+var (
+	// BlueprintFuncs are available in the templates of blueprints.
+	BlueprintFuncs = template.FuncMap{}
+	// CommitMessageFuncs are available in settings.commit-message.
+	CommitMessageFuncs = template.FuncMap{}
+	// CommandFuncs are available in the commands of openers and in
+	// settings.dir-opener.
+	CommandFuncs = template.FuncMap{"quote": Quote}
+)
+
+// Quote quotes a string for use as a single shell word.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
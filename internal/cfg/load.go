@@ -0,0 +1,230 @@
+package cfg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Locate finds the config file: explicit if given (from --config), else
+// $Z_CONFIG, else z/z.yml or z.yml in $XDG_CONFIG_HOME (default ~/.config).
+// If neither exists, the former is where a new config belongs.
+func Locate(explicit string) (string, error) {
+	if explicit != "" {
+		return explicit, nil
+	}
+	if file := os.Getenv("Z_CONFIG"); file != "" {
+		return file, nil
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" || !filepath.IsAbs(dir) {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("could not determine user home directory (%w)", err)
+		}
+		dir = filepath.Join(homeDir, ".config")
+	}
+	candidates := []string{filepath.Join(dir, "z", "z.yml"), filepath.Join(dir, "z.yml")}
+	for _, file := range candidates {
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	return candidates[0], nil
+}
+
+// OverlayPath is the host-specific overlay of a config file, e.g. z.<host>.yml
+// next to z.yml. It is empty if the hostname cannot be determined.
+func OverlayPath(file string) string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return ""
+	}
+	host, _, _ = strings.Cut(host, ".")
+	ext := filepath.Ext(file)
+	return strings.TrimSuffix(file, ext) + "." + host + ext
+}
+
+// Load reads the config from file as Read does, keeping the problems with it
+// in Problems, and expands it (see Expand). A missing file is an error
+// wrapping fs.ErrNotExist.
+func Load(file string) (*Cfg, error) {
+	if _, err := os.Stat(file); err != nil {
+		return nil, fmt.Errorf("could not read config file '%s' (%w)", file, err)
+	}
+	c, problems, err := Read(file)
+	if err != nil {
+		return nil, err
+	}
+	c.Problems = problems
+	if problems := c.Expand(); len(problems) > 0 {
+		errs := make([]error, len(problems))
+		for i := range problems {
+			errs[i] = &problems[i]
+		}
+		return nil, fmt.Errorf("could not expand config (%w)", errors.Join(errs...))
+	}
+	return &c, nil
+}
+
+// Read strictly decodes the config file along with the files it includes and
+// the overlay for this host, if there is one. Included files are merged in
+// beneath the file including them, the overlay on top of everything; mappings
+// are merged key by key, while lists and plain values replace each other.
+//
+// Syntax errors and unreadable files are returned as a *Problem error;
+// everything else wrong with the config, like unknown keys, values of the
+// wrong type and invalid templates, is reported as problems alongside the
+// (partially) decoded config, in the file each came from.
+func Read(file string) (Cfg, []Problem, error) {
+	l := &loader{from: origins{}, reading: map[string]bool{}}
+	root, err := l.load(file)
+	if err != nil {
+		return Cfg{}, nil, err
+	}
+	if overlay := OverlayPath(file); overlay != "" {
+		if _, err := os.Stat(overlay); err == nil {
+			top, err := l.load(overlay)
+			if err != nil {
+				return Cfg{}, nil, err
+			}
+			root = merge(root, top)
+		}
+	}
+
+	c := Cfg{}
+	if root == nil {
+		return c, l.problems, nil
+	}
+	checkKnown(file, l.from, root, reflect.TypeOf(c), "", &l.problems)
+	// type errors were reported per file, where their lines make sense
+	_ = root.Decode(&c)
+	l.problems = append(l.problems, validate(file, l.from, &c, root)...)
+	c.Path, c.root, c.from = file, root, l.from
+	return c, l.problems, nil
+}
+
+// loader reads a config file and its includes.
+type loader struct {
+	from     origins
+	reading  map[string]bool // to detect include cycles
+	problems []Problem
+}
+
+// load reads file, with its includes merged in beneath it. The returned node
+// is the top level mapping, or nil for an empty file.
+func (l *loader) load(file string) (*yaml.Node, error) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve config file '%s' (%s)", file, err.Error())
+	}
+	if l.reading[abs] {
+		return nil, &Problem{File: file, Message: "config file includes itself"}
+	}
+	l.reading[abs] = true
+	defer delete(l.reading, abs)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, &Problem{File: file, Message: fmt.Sprintf("could not read config file (%s)", err.Error())}
+	}
+	doc := &yaml.Node{}
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			// an empty file is an empty config
+			return nil, nil
+		}
+		p := problemOf(file, err.Error())
+		return nil, &p
+	}
+	l.from.record(file, doc)
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+
+	// decode on its own first, so the lines of type errors refer to this file
+	c := Cfg{}
+	if err := root.Decode(&c); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			p := problemOf(file, err.Error())
+			return nil, &p
+		}
+		for _, msg := range typeErr.Errors {
+			l.problems = append(l.problems, problemOf(file, msg))
+		}
+	}
+
+	var base *yaml.Node
+	for i, pattern := range c.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(file), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			l.problems = append(l.problems, l.from.at(file, lookup(root, "include", strconv.Itoa(i)), fmt.Sprintf("invalid include pattern (%s)", err.Error())))
+			continue
+		}
+		if len(matches) == 0 && !hasMeta(pattern) {
+			l.problems = append(l.problems, l.from.at(file, lookup(root, "include", strconv.Itoa(i)), fmt.Sprintf("included file '%s' does not exist", pattern)))
+			continue
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || info.IsDir() {
+				continue
+			}
+			included, err := l.load(match)
+			if err != nil {
+				return nil, err
+			}
+			base = merge(base, included)
+		}
+	}
+	return merge(base, root), nil
+}
+
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// merge merges top onto base: the keys of mappings are merged recursively,
+// anything else in top replaces what is in base. Empty values in top leave
+// base as is.
+func merge(base, top *yaml.Node) *yaml.Node {
+	switch {
+	case base == nil:
+		return top
+	case top == nil || (top.Kind == yaml.ScalarNode && top.Tag == "!!null"):
+		return base
+	case base.Kind != yaml.MappingNode || top.Kind != yaml.MappingNode:
+		return top
+	}
+	merged := *base
+	merged.Content = append([]*yaml.Node{}, base.Content...)
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		key, value := top.Content[i], top.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(merged.Content); j += 2 {
+			if merged.Content[j].Value == key.Value {
+				merged.Content[j+1] = merge(merged.Content[j+1], value)
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged.Content = append(merged.Content, key, value)
+		}
+	}
+	return &merged
+}
@@ -0,0 +1,82 @@
+package cfg
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		base string
+		top  string
+		want string
+	}{
+		{"a: 1", "b: 2", "a: 1\nb: 2"},
+		{"a: 1", "a: 2", "a: 2"},
+		{"a: 1", "a: null", "a: 1"},
+		{"a: 1", "a:", "a: 1"},
+		{"a: {x: 1, y: 2}", "a: {y: 3, z: 4}", "a: {x: 1, y: 3, z: 4}"},
+		{"a: [1, 2]", "a: [3]", "a: [3]"},
+		{"a: {x: 1}", "a: 2", "a: 2"},
+		{"a: 1", "a: {x: 1}", "a: {x: 1}"},
+		{"a: 1\nb: 2", "b: {c: {d: 3}}", "a: 1\nb: {c: {d: 3}}"},
+	}
+	parse := func(s string) *yaml.Node {
+		t.Helper()
+		doc := yaml.Node{}
+		if err := yaml.Unmarshal([]byte(s), &doc); err != nil {
+			t.Fatal(err)
+		}
+		return doc.Content[0]
+	}
+	flat := func(n *yaml.Node) string {
+		t.Helper()
+		var v any
+		if err := n.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		out, err := yaml.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+	for _, tt := range tests {
+		base := parse(tt.base)
+		before := flat(base)
+		got := flat(merge(base, parse(tt.top)))
+		if want := flat(parse(tt.want)); got != want {
+			t.Errorf("merge(%q, %q) = %q, want %q", tt.base, tt.top, got, want)
+		}
+		if after := flat(base); after != before {
+			t.Errorf("merge(%q, %q) changed the base to %q", tt.base, tt.top, after)
+		}
+	}
+	if n := parse("a: 1"); merge(nil, n) != n || merge(n, nil) != n {
+		t.Error("merging with nil should return the other node")
+	}
+}
+
+func TestOverlayPath(t *testing.T) {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		t.Skip("no hostname")
+	}
+	host, _, _ = strings.Cut(host, ".")
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"/home/u/.config/z/z.yml", "/home/u/.config/z/z." + host + ".yml"},
+		{"z.yaml", "z." + host + ".yaml"},
+		{"/etc/zconfig", "/etc/zconfig." + host},
+	}
+	for _, tt := range tests {
+		if got := OverlayPath(tt.file); got != tt.want {
+			t.Errorf("OverlayPath(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package cfg
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"z/internal/ignore"
+
+	"github.com/rs/zerolog/log"
+)
+
+// WalkK walks the tree of a K, calling fn with the path relative to the K and
+// the Z-type of every Z-note and file in it, and of every plain directory if
+// dirs is set. Z-notes are not descended into, but their sources and objects
+// are walked. Hidden files and directories, like .git, and ignored paths are
+// skipped, as is everything deeper than maxDepth levels, unless maxDepth is
+// 0. A K path that is a symlink is followed; paths that cannot be read or
+// classified are skipped with a warning.
+func WalkK(kPath string, maxDepth int, ignored *ignore.Matcher, dirs bool, fn func(rel, zType string) error) error {
+	root, err := filepath.EvalSymlinks(kPath)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			log.Warn().Err(err).Str("path", p).Msg("could not read, skipping")
+			return nil
+		}
+		if p == root {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ignored.Ignored(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		depth := strings.Count(rel, "/") + 1
+		if maxDepth > 0 && depth > maxDepth {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		zType, err := Classify(root, rel)
+		if err != nil {
+			log.Warn().Err(err).Str("path", p).Msg("could not classify, skipping")
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if zType != "D" || dirs {
+			if err := fn(rel, zType); err != nil {
+				return err
+			}
+		}
+		switch {
+		case zType == "Z":
+			z, err := ReadZ(p)
+			if err != nil {
+				log.Warn().Err(err).Str("note", rel).Msg("could not read Z-note, skipping its sources and objects")
+				return filepath.SkipDir
+			}
+			for _, source := range z.Sources {
+				if err := fn(path.Join(rel, source), "S"); err != nil {
+					return err
+				}
+			}
+			for _, object := range z.Objects {
+				if err := fn(path.Join(rel, object), "O"); err != nil {
+					return err
+				}
+			}
+			return filepath.SkipDir
+		case d.IsDir() && maxDepth > 0 && depth == maxDepth:
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
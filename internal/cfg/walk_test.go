@@ -0,0 +1,71 @@
+package cfg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"z/internal/ignore"
+)
+
+func TestWalkK(t *testing.T) {
+	k := makeK(t,
+		[]string{"a.md", ".hidden.md", ".git/config", "plain/b.md", "plain/deeper/c.md", "empty/", "note/main.tex", "note/main.pdf", "note/other.md"},
+		map[string]Z{"note": {Sources: []string{"main.tex"}, Objects: []string{"main.pdf"}}},
+	)
+	walk := func(kPath string, maxDepth int, ignored *ignore.Matcher, dirs bool) []string {
+		t.Helper()
+		got := []string{}
+		err := WalkK(kPath, maxDepth, ignored, dirs, func(rel, zType string) error {
+			got = append(got, zType+" "+rel)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	tests := []struct {
+		maxDepth int
+		dirs     bool
+		want     []string
+	}{
+		{0, false, []string{"F a.md", "Z note", "S note/main.tex", "O note/main.pdf", "F plain/b.md", "F plain/deeper/c.md"}},
+		{0, true, []string{"F a.md", "D empty", "Z note", "S note/main.tex", "O note/main.pdf", "D plain", "F plain/b.md", "D plain/deeper", "F plain/deeper/c.md"}},
+		{1, false, []string{"F a.md", "Z note", "S note/main.tex", "O note/main.pdf"}},
+		{2, true, []string{"F a.md", "D empty", "Z note", "S note/main.tex", "O note/main.pdf", "D plain", "F plain/b.md", "D plain/deeper"}},
+	}
+	for _, tt := range tests {
+		if got := walk(k, tt.maxDepth, nil, tt.dirs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("WalkK(maxDepth %d, dirs %v) visited %q, want %q", tt.maxDepth, tt.dirs, got, tt.want)
+		}
+	}
+
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(k, link); err == nil {
+		if got := walk(link, 0, nil, false); !reflect.DeepEqual(got, tests[0].want) {
+			t.Errorf("WalkK() through a symlink visited %q, want %q", got, tests[0].want)
+		}
+	}
+
+	want := []string{"F a.md", "Z note", "S note/main.tex", "O note/main.pdf", "D plain", "F plain/b.md"}
+	if got := walk(k, 0, ignore.New(k, []string{"deeper/", "empty"}), true); !reflect.DeepEqual(got, want) {
+		t.Errorf("WalkK() with ignored paths visited %q, want %q", got, want)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := WalkK(k, 0, nil, false, func(string, string) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("WalkK() went on after an error, returning %v after %d calls", err, calls)
+	}
+	if err := WalkK(filepath.Join(k, "missing"), 0, nil, false, func(string, string) error { return nil }); err == nil {
+		t.Errorf("WalkK() of a missing K succeeded")
+	}
+}
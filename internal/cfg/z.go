@@ -31,3 +31,25 @@ func ReadZ(dir string) (*Z, error) {
 	}
 	return &z, nil
 }
+
+// IsNote tells whether dir is a Z-note, i.e., contains a .z/z.yml.
+func IsNote(dir string) bool {
+	info, err := os.Stat(path.Join(dir, ".z", "z.yml"))
+	return err == nil && !info.IsDir()
+}
+
+// WriteZ writes a Z-note's .z/z.yml into dir, creating .z if needed.
+func WriteZ(dir string, z Z) error {
+	zDir := path.Join(dir, ".z")
+	if err := os.MkdirAll(zDir, 0755); err != nil {
+		return err
+	}
+	zYAML, err := yaml.Marshal(z)
+	if err != nil {
+		return fmt.Errorf("unable to marshal z yaml (%s)", err.Error())
+	}
+	if err := os.WriteFile(path.Join(zDir, "z.yml"), zYAML, 0644); err != nil {
+		return fmt.Errorf("error writing '.z/z.yml' (%s)", err.Error())
+	}
+	return nil
+}
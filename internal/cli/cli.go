@@ -1,6 +1,10 @@
 package cli
 
+import "z/internal/cfg"
+
 type CommandLineOpts struct {
+	ConfigFile string `long:"config" value-name:"FILE" description:"Config file to use (default: $Z_CONFIG, or z/z.yml or z.yml in $XDG_CONFIG_HOME)"`
+
 	Version VersionCommand `command:"version" description:"Display version information"`
 
 	Init InitCommand `command:"init" description:"Initialize z: create config if missing, set up all Ks (clone remote, init local)"`
@@ -14,13 +18,32 @@ type CommandLineOpts struct {
 	Preview        PreviewCommand        `command:"preview" description:"Preview a file in the terminal"`
 	EnumerateFiles EnumerateFilesCommand `command:"enumerate-files" description:"List all files across all Ks"`
 
+	Config ConfigCommand `command:"config" description:"Inspect and check the config file"`
+
 	Open OpenCommand `command:"open" description:"Open a file, directory, or Z-note with the appropriate application"`
 
 	S    SyncCommand `command:"s" description:"Sync all Ks with their git remotes (short for 'sync')"`
 	Sync SyncCommand `command:"sync" description:"Synchronize all Ks: commit local changes, pull from remote, and push"`
 
+	Status StatusCommand `command:"status" description:"Show uncommitted changes and unpushed/unpulled commits per K, without changing anything"`
+	Daemon DaemonCommand `command:"daemon" description:"Watch all Ks, auto-commit changes once they settle, and sync periodically"`
+
 	M    MakeCommand `command:"m" description:"Run post-processing commands for a Z-note (short for 'make')"`
 	Make MakeCommand `command:"make" description:"Execute post-processing commands defined in a Z-note's .z/z.yml"`
 }
 
 var Opts CommandLineOpts
+
+// Configurable is implemented by the commands that need the config, which
+// is handed to them before they are executed.
+type Configurable interface {
+	SetConfig(config *cfg.Cfg)
+}
+
+// configured is embedded by commands to receive the config.
+type configured struct {
+	config *cfg.Cfg
+}
+
+// SetConfig sets the config the command runs with.
+func (c *configured) SetConfig(config *cfg.Cfg) { c.config = config }
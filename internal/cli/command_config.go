@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"z/internal/cfg"
+)
+
+// ConfigCommand groups the commands dealing with the config file.
+type ConfigCommand struct {
+	Check     ConfigCheckCommand     `command:"check" description:"Check the config file, its includes and overlay for unknown keys, invalid values and templates; exits non-zero on problems"`
+	Get       ConfigGetCommand       `command:"get" description:"Print a setting, e.g. settings.sync-jobs, as it is in effect"`
+	Set       ConfigSetCommand       `command:"set" description:"Change a setting, e.g. settings.sync-jobs, in the config file"`
+	K         ConfigKCommand         `command:"k" description:"List, add or remove Ks in the config file"`
+	Blueprint ConfigBlueprintCommand `command:"blueprint" description:"List and show blueprints"`
+}
+
+// ConfigCheckCommand reports every problem with a config file.
+type ConfigCheckCommand struct {
+	configured
+
+	Args struct {
+		File string `positional-arg-name:"file" description:"Config file to check (default: the one z reads)"`
+	} `positional-args:"yes"`
+}
+
+// Execute checks the config file.
+func (c *ConfigCheckCommand) Execute(_ []string) error {
+	file := c.Args.File
+	if file == "" {
+		file = c.config.Path
+	}
+
+	config, problems, err := cfg.Read(file)
+	var syntaxErr *cfg.Problem
+	if errors.As(err, &syntaxErr) {
+		problems = append(problems, *syntaxErr)
+	} else if err != nil {
+		return err
+	} else {
+		problems = append(problems, config.Expand()...)
+	}
+	for _, problem := range problems {
+		fmt.Println(problem.String())
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problem(s) in '%s'", len(problems), file)
+	}
+	fmt.Printf("%s: ok\n", file)
+	return nil
+}
@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigBlueprintCommand groups the commands that inspect blueprints.
+type ConfigBlueprintCommand struct {
+	List ConfigBlueprintListCommand `command:"list" description:"List the IDs of all blueprints"`
+	Show ConfigBlueprintShowCommand `command:"show" description:"Print a blueprint as YAML"`
+}
+
+// ConfigBlueprintListCommand lists the blueprints.
+type ConfigBlueprintListCommand struct {
+	configured
+}
+
+// Execute prints the IDs of the blueprints, one per line.
+func (c *ConfigBlueprintListCommand) Execute(_ []string) error {
+	ids := make([]string, 0, len(c.config.Blueprints))
+	for id := range c.config.Blueprints {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Println(id)
+	}
+	return nil
+}
+
+// ConfigBlueprintShowCommand prints a blueprint.
+type ConfigBlueprintShowCommand struct {
+	configured
+
+	Args struct {
+		ID string `positional-arg-name:"id" required:"yes" description:"ID of the blueprint to show"`
+	} `positional-args:"yes"`
+}
+
+// Execute prints the blueprint as it is in effect, after includes and
+// overlays are merged.
+func (c *ConfigBlueprintShowCommand) Execute(_ []string) error {
+	blueprint, ok := c.config.Blueprints[c.Args.ID]
+	if !ok {
+		return fmt.Errorf("no such blueprint '%s'", c.Args.ID)
+	}
+	out, err := yaml.Marshal(blueprint)
+	if err != nil {
+		return fmt.Errorf("unable to marshal blueprint (%s)", err.Error())
+	}
+	fmt.Print(string(out))
+	return nil
+}
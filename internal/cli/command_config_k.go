@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"z/internal/cfg"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigKCommand groups the commands that list, add and remove Ks.
+type ConfigKCommand struct {
+	List ConfigKListCommand `command:"list" description:"List the IDs and paths of all Ks"`
+	Add  ConfigKAddCommand  `command:"add" description:"Add a K to the config file (set it up with 'z init')"`
+	Rm   ConfigKRmCommand   `command:"rm" description:"Remove a K from the config file, leaving its files alone"`
+}
+
+// ConfigKListCommand lists the Ks.
+type ConfigKListCommand struct {
+	configured
+}
+
+// Execute prints the ID and path of each K, separated by a tab, one per line.
+func (c *ConfigKListCommand) Execute(_ []string) error {
+	ids := make([]string, 0, len(c.config.Ks))
+	for id := range c.config.Ks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Printf("%s\t%s\n", id, c.config.Ks[id].Path)
+	}
+	return nil
+}
+
+// ConfigKAddCommand adds a K to the config file.
+type ConfigKAddCommand struct {
+	configured
+
+	Path string `long:"path" required:"yes" description:"Directory of the K"`
+	URL  string `long:"url" description:"Git remote to clone the K from and sync it with (default: none, local only)"`
+	Args struct {
+		ID string `positional-arg-name:"id" required:"yes" description:"ID of the new K"`
+	} `positional-args:"yes"`
+}
+
+// Execute adds the K.
+func (c *ConfigKAddCommand) Execute(_ []string) error {
+	id := c.Args.ID
+	if _, exists := c.config.Ks[id]; exists {
+		return fmt.Errorf("K '%s' already exists", id)
+	}
+	kPath := c.Path
+	if !filepath.IsAbs(kPath) && !strings.HasPrefix(kPath, "~") && !strings.HasPrefix(kPath, "$") {
+		// relative to where z is run now, which means nothing later on
+		abs, err := filepath.Abs(kPath)
+		if err != nil {
+			return fmt.Errorf("could not resolve path '%s' (%s)", kPath, err.Error())
+		}
+		kPath = abs
+	}
+
+	k := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	k.Content = append(k.Content, scalar("path"), scalar(kPath))
+	if c.URL != "" {
+		k.Content = append(k.Content, scalar("url"), scalar(c.URL))
+	}
+	editor, err := cfg.Edit(c.config.Path)
+	if err != nil {
+		return err
+	}
+	editor.Set(k, "Ks", id)
+	if err := editor.Save(); err != nil {
+		return fmt.Errorf("not adding K '%s' (%s)", id, err.Error())
+	}
+	log.Info().Str("path", c.config.Path).Str("K", id).Msg("added K, run 'z init' to set it up")
+	return nil
+}
+
+// ConfigKRmCommand removes a K from the config file.
+type ConfigKRmCommand struct {
+	configured
+
+	Args struct {
+		ID string `positional-arg-name:"id" required:"yes" description:"ID of the K to remove"`
+	} `positional-args:"yes"`
+}
+
+// Execute removes the K. Ks defined in included files or the overlay have to
+// be removed there.
+func (c *ConfigKRmCommand) Execute(_ []string) error {
+	id := c.Args.ID
+	if _, exists := c.config.Ks[id]; !exists {
+		return fmt.Errorf("no such K '%s'", id)
+	}
+	editor, err := cfg.Edit(c.config.Path)
+	if err != nil {
+		return err
+	}
+	if !editor.Delete("Ks", id) {
+		return fmt.Errorf("K '%s' is not defined in '%s', but in a file it includes or its overlay", id, c.config.Path)
+	}
+	if err := editor.Save(); err != nil {
+		return fmt.Errorf("not removing K '%s' (%s)", id, err.Error())
+	}
+	log.Info().Str("path", c.config.Path).Str("K", id).Str("dir", c.config.Ks[id].Path).Msg("removed K, its files are left alone")
+	return nil
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
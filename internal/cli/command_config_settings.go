@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"z/internal/cfg"
+
+	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigGetCommand prints a setting.
+type ConfigGetCommand struct {
+	configured
+
+	Args struct {
+		Key string `positional-arg-name:"key" required:"yes" description:"Setting to print, e.g. settings.daemon.quiet-period, or just settings for all"`
+	} `positional-args:"yes"`
+}
+
+// Execute prints the setting, plain values as they are and everything else
+// as YAML.
+func (c *ConfigGetCommand) Execute(_ []string) error {
+	keys, err := settingKeys(c.Args.Key)
+	if err != nil {
+		return err
+	}
+	settings := yaml.Node{}
+	if err := settings.Encode(c.config.Settings); err != nil {
+		return fmt.Errorf("unable to marshal settings (%s)", err.Error())
+	}
+	n := &settings
+	for _, key := range keys[1:] {
+		var next *yaml.Node
+		for i := 0; n.Kind == yaml.MappingNode && i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				next = n.Content[i+1]
+			}
+		}
+		if next == nil {
+			if !knownSetting(keys[1:]) {
+				return fmt.Errorf("unknown setting '%s'", c.Args.Key)
+			}
+			// unset settings are left out when encoding
+			return nil
+		}
+		n = next
+	}
+
+	if n.Kind == yaml.ScalarNode {
+		if n.Tag != "!!null" {
+			fmt.Println(n.Value)
+		}
+		return nil
+	}
+	out, err := yaml.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("unable to marshal setting (%s)", err.Error())
+	}
+	fmt.Print(string(out))
+	return nil
+}
+
+// ConfigSetCommand changes a setting in the config file.
+type ConfigSetCommand struct {
+	configured
+
+	Args struct {
+		Key   string `positional-arg-name:"key" required:"yes" description:"Setting to change, e.g. settings.sync-jobs"`
+		Value string `positional-arg-name:"value" required:"yes" description:"New value, in YAML, e.g. 8, false, 30s or '[build, \"*.tmp\"]'"`
+	} `positional-args:"yes"`
+}
+
+// Execute sets the setting in the config file, refusing values that make the
+// config invalid.
+func (c *ConfigSetCommand) Execute(_ []string) error {
+	keys, err := settingKeys(c.Args.Key)
+	if err != nil {
+		return err
+	}
+	if len(keys) < 2 {
+		return fmt.Errorf("name a single setting to change, like settings.sync-jobs")
+	}
+	value := yaml.Node{}
+	if err := yaml.Unmarshal([]byte(c.Args.Value), &value); err != nil {
+		return fmt.Errorf("invalid value (%s)", err.Error())
+	}
+	if len(value.Content) == 0 {
+		// an empty value unsets the setting
+		value.Content = []*yaml.Node{{Kind: yaml.ScalarNode, Tag: "!!null"}}
+	}
+
+	editor, err := cfg.Edit(c.config.Path)
+	if err != nil {
+		return err
+	}
+	editor.Set(value.Content[0], keys...)
+	if err := editor.Save(); err != nil {
+		return fmt.Errorf("not changing '%s' (%s)", c.Args.Key, err.Error())
+	}
+	log.Info().Str("path", c.config.Path).Str("key", c.Args.Key).Str("value", c.Args.Value).Msg("changed setting")
+	return nil
+}
+
+// knownSetting tells whether the path of keys below settings names a field
+// of the settings.
+func knownSetting(keys []string) bool {
+	t := reflect.TypeOf(cfg.Settings{})
+	for _, key := range keys {
+		if t.Kind() != reflect.Struct {
+			return false
+		}
+		found := false
+		for i := range t.NumField() {
+			if name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ","); name == key {
+				t, found = t.Field(i).Type, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// settingKeys splits the dotted key of a setting.
+func settingKeys(key string) ([]string, error) {
+	keys := strings.Split(key, ".")
+	if keys[0] != "settings" {
+		return nil, fmt.Errorf("only settings can be read and changed this way, not '%s' (for Ks, see 'z config k')", key)
+	}
+	return keys, nil
+}
@@ -12,12 +12,13 @@ import (
 	"time"
 
 	"github.com/rs/zerolog/log"
-	"gopkg.in/yaml.v3"
 
 	"z/internal/cfg"
 )
 
 type CreateCommand struct {
+	configured
+
 	Args struct {
 		K         string `positional-arg-name:"K" required:"yes" description:"ID of the knowledge base (K) to create in"`
 		Name      string `positional-arg-name:"name" required:"yes" description:"Name for the new note/file"`
@@ -27,10 +28,10 @@ type CreateCommand struct {
 
 func (c *CreateCommand) Execute(_ []string) error {
 	kID := c.Args.K
-	k, kOK := cfg.GlobalCfg.Ks[kID]
+	k, kOK := c.config.Ks[kID]
 	if !kOK {
-		available := make([]string, 0, len(cfg.GlobalCfg.Ks))
-		for id := range cfg.GlobalCfg.Ks {
+		available := make([]string, 0, len(c.config.Ks))
+		for id := range c.config.Ks {
 			available = append(available, id)
 		}
 		return fmt.Errorf("no such K '%s'\nAvailable Ks: %s", kID, strings.Join(available, ", "))
@@ -41,10 +42,10 @@ func (c *CreateCommand) Execute(_ []string) error {
 	var blueprint cfg.Blueprint
 	if blueprintID != "" {
 		var ok bool
-		blueprint, ok = cfg.GlobalCfg.Blueprints[blueprintID]
+		blueprint, ok = c.config.Blueprints[blueprintID]
 		if !ok {
-			available := make([]string, 0, len(cfg.GlobalCfg.Blueprints))
-			for id := range cfg.GlobalCfg.Blueprints {
+			available := make([]string, 0, len(c.config.Blueprints))
+			for id := range c.config.Blueprints {
 				available = append(available, id)
 			}
 			if len(available) > 0 {
@@ -64,43 +65,10 @@ func (c *CreateCommand) Execute(_ []string) error {
 		Now:   time.Now().Local().Format(time.RFC3339),
 	}
 
-	fillTemplate := func(t string) (string, error) {
-		tmpl, err := template.New("tmpl").Parse(t)
-		if err != nil {
-			return "", fmt.Errorf("unable to parse template '%s' (%s)", t, err.Error())
-		}
-
-		b := bytes.Buffer{}
-		if err := tmpl.Execute(&b, dd); err != nil {
-			return "", fmt.Errorf("could not execute template (%s)", err.Error())
-		}
-		return b.String(), nil
-	}
-
-	openTmpl, err := template.New("openStr").Parse(blueprint.Open)
-	if err != nil {
-		log.Fatal().Err(err).Str("template", blueprint.Open).
-			Msg("unable to parse open template")
-	}
-
-	var openStr string
-	oBuf := bytes.Buffer{}
-	if err := openTmpl.Execute(&oBuf, dd); err != nil {
-		return fmt.Errorf("could not execute open template (%s)", err.Error())
-	}
-	openStr = oBuf.String()
-
-	viewTmpl, err := template.New("viewStr").Parse(blueprint.View)
+	z, err := fillZ(blueprint, dd)
 	if err != nil {
-		log.Fatal().Err(err).Str("template", blueprint.View).
-			Msg("unable to parse view template")
-	}
-	var viewStr string
-	vBuf := bytes.Buffer{}
-	if err := viewTmpl.Execute(&vBuf, dd); err != nil {
-		return fmt.Errorf("could not execute open template (%s)", err.Error())
+		return err
 	}
-	viewStr = vBuf.String()
 
 	hasSubdir := blueprint.Subdir != ""
 	if !hasSubdir {
@@ -112,7 +80,7 @@ func (c *CreateCommand) Execute(_ []string) error {
 		}
 	}
 	subdir, subdirTmplErr := func() (string, error) {
-		tmpl, err := template.New("subdir").Parse(blueprint.Subdir)
+		tmpl, err := template.New("subdir").Funcs(cfg.BlueprintFuncs).Parse(blueprint.Subdir)
 		if err != nil {
 			return "", fmt.Errorf("unable to parse subdir template")
 		}
@@ -128,12 +96,12 @@ func (c *CreateCommand) Execute(_ []string) error {
 
 	filesWithContent := map[string]string{}
 	for filepathTemplate, contentTemplate := range blueprint.Templates {
-		f, err := template.New("filepath").Parse(filepathTemplate)
+		f, err := template.New("filepath").Funcs(cfg.BlueprintFuncs).Parse(filepathTemplate)
 		if err != nil {
 			log.Fatal().Err(err).Str("template", filepathTemplate).
 				Msg("unable to parse filepath template (key)")
 		}
-		c, err := template.New("content").Parse(contentTemplate)
+		c, err := template.New("content").Funcs(cfg.BlueprintFuncs).Parse(contentTemplate)
 		if err != nil {
 			log.Fatal().Err(err).Str("template", contentTemplate).
 				Msg("unable to parse content template (value)")
@@ -199,61 +167,14 @@ func (c *CreateCommand) Execute(_ []string) error {
 	}
 
 	// create .z dir in subdir, if there is a subdir
-	pFilled := make([]string, len(blueprint.Post))
 	if hasSubdir {
-		err := func() error {
-			zDir := path.Join(k.Path, subdir, ".z")
-			if err := os.MkdirAll(zDir, 0755); err != nil {
-				return err
-			}
-
-			for i := range blueprint.Post {
-				var err error
-				pFilled[i], err = fillTemplate(blueprint.Post[i])
-				if err != nil {
-					return err
-				}
-			}
-			sFilled := make([]string, len(blueprint.Sources))
-			for i := range blueprint.Sources {
-				var err error
-				sFilled[i], err = fillTemplate(blueprint.Sources[i])
-				if err != nil {
-					return err
-				}
-			}
-			oFilled := make([]string, len(blueprint.Objects))
-			for i := range blueprint.Objects {
-				var err error
-				oFilled[i], err = fillTemplate(blueprint.Objects[i])
-				if err != nil {
-					return err
-				}
-			}
-			zYAML, marshalErr := yaml.Marshal(cfg.Z{
-				Open:    openStr,
-				View:    viewStr,
-				Post:    pFilled,
-				Sources: sFilled,
-				Objects: oFilled,
-			})
-			if marshalErr != nil {
-				return fmt.Errorf("unable to marshal z yaml (%s)", marshalErr.Error())
-			}
-			if err := os.WriteFile(path.Join(zDir, "z.yml"), zYAML, 0644); err != nil {
-				return fmt.Errorf("error writing '.z/z.yml' (%s)", err.Error())
-			}
-
-			return nil
-		}()
-
-		if err != nil {
+		if err := cfg.WriteZ(path.Join(k.Path, subdir), z); err != nil {
 			return fmt.Errorf("unable to create z dir (%s)", err.Error())
 		}
 	}
 
 	// run the open command
-	openCmd := &OpenCommand{}
+	openCmd := &OpenCommand{configured: configured{c.config}}
 	openCmd.Args.K = kID
 	openCmd.Args.File = func() string {
 		if hasSubdir {
@@ -271,3 +192,49 @@ func (c *CreateCommand) Execute(_ []string) error {
 	}()
 	return openCmd.Execute(nil)
 }
+
+// fillTemplate fills a blueprint template.
+func fillTemplate(t string, dd cfg.TemplateFiller) (string, error) {
+	tmpl, err := template.New("tmpl").Funcs(cfg.BlueprintFuncs).Parse(t)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse template '%s' (%s)", t, err.Error())
+	}
+
+	b := bytes.Buffer{}
+	if err := tmpl.Execute(&b, dd); err != nil {
+		return "", fmt.Errorf("could not execute template (%s)", err.Error())
+	}
+	return b.String(), nil
+}
+
+// fillZ fills the Z-note data (the contents of .z/z.yml) from a blueprint.
+func fillZ(blueprint cfg.Blueprint, dd cfg.TemplateFiller) (cfg.Z, error) {
+	z := cfg.Z{
+		Post:    make([]string, len(blueprint.Post)),
+		Sources: make([]string, len(blueprint.Sources)),
+		Objects: make([]string, len(blueprint.Objects)),
+	}
+	var err error
+	if z.Open, err = fillTemplate(blueprint.Open, dd); err != nil {
+		return cfg.Z{}, err
+	}
+	if z.View, err = fillTemplate(blueprint.View, dd); err != nil {
+		return cfg.Z{}, err
+	}
+	for i := range blueprint.Post {
+		if z.Post[i], err = fillTemplate(blueprint.Post[i], dd); err != nil {
+			return cfg.Z{}, err
+		}
+	}
+	for i := range blueprint.Sources {
+		if z.Sources[i], err = fillTemplate(blueprint.Sources[i], dd); err != nil {
+			return cfg.Z{}, err
+		}
+	}
+	for i := range blueprint.Objects {
+		if z.Objects[i], err = fillTemplate(blueprint.Objects[i], dd); err != nil {
+			return cfg.Z{}, err
+		}
+	}
+	return z, nil
+}
@@ -0,0 +1,356 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"z/internal/cfg"
+	"z/internal/gitsync"
+	"z/internal/ignore"
+	"z/internal/watch"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultQuietPeriod  = 30 * time.Second
+	defaultSyncInterval = 10 * time.Minute
+)
+
+// DaemonCommand watches all Ks, commits changes once they settle and
+// periodically syncs.
+type DaemonCommand struct {
+	configured
+
+	Status bool `long:"status" description:"Print the status of the running daemon as JSON and exit"`
+}
+
+// daemonStatus is what the daemon writes to its status file.
+type daemonStatus struct {
+	PID     int                      `json:"pid"`
+	Started time.Time                `json:"started"`
+	Updated time.Time                `json:"updated"`
+	Ks      map[string]*daemonKState `json:"ks"`
+}
+
+// daemonKState is the daemon's view of a single K.
+type daemonKState struct {
+	Watching   bool      `json:"watching"`
+	Pending    bool      `json:"pending"` // changed, waiting for the quiet period to pass
+	LastCommit time.Time `json:"last_commit,omitzero"`
+	LastSync   time.Time `json:"last_sync,omitzero"`
+	SyncStatus string    `json:"sync_status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// daemonStatusPath is where the daemon's status file lives.
+func daemonStatusPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = path.Join(os.TempDir(), fmt.Sprintf("z-%d", os.Getuid()))
+	}
+	return path.Join(dir, "z", "daemon.json")
+}
+
+// Execute runs the daemon until it receives SIGINT or SIGTERM.
+func (c *DaemonCommand) Execute(_ []string) error {
+	statusPath := daemonStatusPath()
+	if c.Status {
+		return printDaemonStatus(statusPath)
+	}
+	if running, err := readDaemonStatus(statusPath); err == nil && processAlive(running.PID) {
+		return fmt.Errorf("daemon already running (pid %d)", running.PID)
+	}
+
+	quiet := c.config.Settings.Daemon.QuietPeriod
+	if quiet <= 0 {
+		quiet = defaultQuietPeriod
+	}
+	interval := c.config.Settings.Daemon.SyncInterval
+	if interval == 0 {
+		interval = defaultSyncInterval
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	matchers := map[string]*ignore.Matcher{}
+	for kID, k := range c.config.Ks {
+		matchers[kID] = c.config.Ignore(k)
+	}
+	watcher, err := watch.New(func(dir string) bool {
+		if path.Base(dir) == ".git" {
+			return true
+		}
+		// ignored directories are not worth a watch each
+		kID, rel, err := c.config.KOf(dir)
+		return err == nil && matchers[kID].Ignored(filepath.ToSlash(rel), true)
+	})
+	if err != nil {
+		return err
+	}
+
+	status := &daemonStatus{PID: os.Getpid(), Started: time.Now(), Ks: map[string]*daemonKState{}}
+	ids := make([]string, 0, len(c.config.Ks))
+	for kID, k := range c.config.Ks {
+		state := &daemonKState{}
+		status.Ks[kID] = state
+		if k.URL == "" {
+			// Ks without a remote are synced by hand
+			log.Debug().Str("K", kID).Msg("not watching K without url")
+			continue
+		}
+		ids = append(ids, kID)
+		if err := watcher.AddTree(k.Path); err != nil {
+			state.Error = err.Error()
+			log.Warn().Err(err).Str("K", kID).Msg("not watching K")
+			continue
+		}
+		state.Watching = true
+	}
+	sort.Strings(ids)
+	writeStatus := func() {
+		status.Updated = time.Now()
+		if err := writeDaemonStatus(statusPath, status); err != nil {
+			log.Warn().Err(err).Str("path", statusPath).Msg("could not write daemon status")
+		}
+	}
+	writeStatus()
+	defer func() {
+		if err := os.Remove(statusPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Warn().Err(err).Str("path", statusPath).Msg("could not remove daemon status")
+		}
+	}()
+	log.Info().Dur("quiet-period", quiet).Dur("sync-interval", interval).Str("status", statusPath).Msg("daemon started")
+
+	// commits and syncs run one at a time in a worker, so that changes keep
+	// being consumed while git talks to a slow remote; every job is queued at
+	// most once, so neither channel ever fills up
+	jobs := make(chan daemonJob, 2*len(ids))
+	results := make(chan daemonResult, 2*len(ids))
+	queued := map[daemonJob]bool{}
+	enqueue := func(j daemonJob) {
+		if !queued[j] {
+			queued[j] = true
+			jobs <- j
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for j := range jobs {
+			if ctx.Err() != nil {
+				continue
+			}
+			results <- c.runDaemonJob(j)
+		}
+	}()
+	defer func() {
+		close(jobs)
+		<-done
+	}()
+
+	// timers fire into settled once a K has been quiet for long enough
+	settled := make(chan string, len(ids))
+	timers := map[string]*time.Timer{}
+	defer func() {
+		for _, t := range timers {
+			t.Stop()
+		}
+	}()
+
+	syncAll := func() {
+		for _, kID := range ids {
+			enqueue(daemonJob{kID: kID, sync: true})
+		}
+	}
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+		syncAll()
+	}
+
+	changes := watcher.Changes
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("shutting down daemon")
+			if err := watcher.Close(); err != nil {
+				log.Warn().Err(err).Msg("could not close watcher")
+			}
+			// drain until the watcher is done
+			for range changes {
+			}
+			return nil
+
+		case changed, ok := <-changes:
+			if !ok {
+				return fmt.Errorf("watcher stopped unexpectedly")
+			}
+			kID, ok := c.daemonKOf(changed)
+			if !ok || c.config.Ks[kID].URL == "" {
+				continue
+			}
+			if t, ok := timers[kID]; ok {
+				t.Reset(quiet)
+			} else {
+				timers[kID] = time.AfterFunc(quiet, func() { settled <- kID })
+			}
+			if state := status.Ks[kID]; !state.Pending {
+				state.Pending = true
+				writeStatus()
+			}
+
+		case kID := <-settled:
+			status.Ks[kID].Pending = false
+			enqueue(daemonJob{kID: kID})
+			writeStatus()
+
+		case r := <-results:
+			delete(queued, r.daemonJob)
+			state := status.Ks[r.kID]
+			if r.sync {
+				state.LastSync, state.SyncStatus = r.at, r.status
+			}
+			state.Error = ""
+			if r.err != nil {
+				state.Error = r.err.Error()
+			} else if !r.sync {
+				state.LastCommit = r.at
+			}
+			writeStatus()
+
+		case <-tick:
+			syncAll()
+		}
+	}
+}
+
+// daemonJob is a commit or, if sync is set, a sync of a single K.
+type daemonJob struct {
+	kID  string
+	sync bool
+}
+
+// daemonResult is the outcome of a daemonJob.
+type daemonResult struct {
+	daemonJob
+	at     time.Time
+	status string // of a sync
+	err    error
+}
+
+// runDaemonJob commits or syncs a K.
+func (c *configured) runDaemonJob(j daemonJob) daemonResult {
+	k := c.config.Ks[j.kID]
+	if !j.sync {
+		err := c.autoCommit(j.kID, k)
+		if err != nil {
+			log.Warn().Err(err).Str("K", j.kID).Msg("auto-commit failed")
+		}
+		return daemonResult{daemonJob: j, at: time.Now(), err: err}
+	}
+	r := (&SyncCommand{configured: configured{c.config}}).syncK(j.kID, k)
+	if r.err != nil {
+		log.Warn().Err(r.err).Str("K", j.kID).Str("output", r.output.String()).Msg("sync failed")
+	} else {
+		log.Info().Str("K", j.kID).Str("status", r.status).Msg("synced")
+	}
+	return daemonResult{daemonJob: j, at: time.Now(), status: r.status, err: r.err}
+}
+
+// daemonKOf finds the K a changed path belongs to, ignoring changes that
+// should not cause a commit, like editor swap files.
+func (c *configured) daemonKOf(changed string) (string, bool) {
+	base := filepath.Base(changed)
+	if strings.HasPrefix(base, ".") && base != ".z" || strings.HasSuffix(base, "~") {
+		return "", false
+	}
+	kID, rel, err := c.config.KOf(changed)
+	if err != nil {
+		return "", false
+	}
+	if strings.HasPrefix(rel, ".git"+string(filepath.Separator)) || rel == ".git" {
+		return "", false
+	}
+	return kID, true
+}
+
+// autoCommit commits a K's uncommitted changes, unless its sync policy turns
+// auto-commit off.
+func (c *configured) autoCommit(kID string, k cfg.K) error {
+	if k.Sync.AutoCommit != nil && !*k.Sync.AutoCommit {
+		return nil
+	}
+	repo := &gitsync.Repo{Dir: k.Path, Ignore: c.ignoreFunc(k)}
+	status, err := repo.Status()
+	if err != nil {
+		return err
+	}
+	if len(status.Dirty) == 0 {
+		return nil
+	}
+	if err := repo.CommitAll(c.commitMessage(kID, k)); err != nil {
+		return err
+	}
+	log.Info().Str("K", kID).Int("changes", len(status.Dirty)).Msg("committed changes")
+	return nil
+}
+
+func readDaemonStatus(statusPath string) (*daemonStatus, error) {
+	data, err := os.ReadFile(statusPath)
+	if err != nil {
+		return nil, err
+	}
+	status := &daemonStatus{}
+	if err := json.Unmarshal(data, status); err != nil {
+		return nil, fmt.Errorf("unable to parse '%s' (%s)", statusPath, err.Error())
+	}
+	return status, nil
+}
+
+// writeDaemonStatus replaces the status file atomically, so readers never
+// see a partial one.
+func writeDaemonStatus(statusPath string, status *daemonStatus) error {
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(statusPath), 0700); err != nil {
+		return err
+	}
+	tmp := statusPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, statusPath)
+}
+
+func printDaemonStatus(statusPath string) error {
+	status, err := readDaemonStatus(statusPath)
+	if errors.Is(err, fs.ErrNotExist) || err == nil && !processAlive(status.PID) {
+		return fmt.Errorf("daemon is not running")
+	}
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
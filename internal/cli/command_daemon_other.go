@@ -0,0 +1,19 @@
+//go:build !unix
+
+package cli
+
+import "os"
+
+// processAlive tells whether a process with the given PID exists. Finding a
+// process only fails for ones that do not exist on platforms other than unix.
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
@@ -0,0 +1,10 @@
+//go:build unix
+
+package cli
+
+import "syscall"
+
+// processAlive tells whether a process with the given PID exists.
+func processAlive(pid int) bool {
+	return pid > 0 && syscall.Kill(pid, 0) == nil
+}
@@ -1,21 +1,47 @@
 package cli
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"z/internal/cfg"
 
 	"github.com/rs/zerolog/log"
 )
 
 type EnumerateFilesCommand struct {
-	K        bool `long:"k" description:"show k name"`
-	FileName bool `long:"file-name" description:"show file name"`
-	FileType bool `long:"file-type" description:"show file type"`
-	FullPath bool `long:"full-path" description:"show full path"`
+	configured
+
+	K        bool   `long:"k" description:"show k name"`
+	FileName bool   `long:"file-name" description:"show file name"`
+	FileType bool   `long:"file-type" description:"show file type"`
+	FullPath bool   `long:"full-path" description:"show full path"`
+	MTime    bool   `long:"mtime" description:"show modification time"`
+	Size     bool   `long:"size" description:"show size in bytes"`
+	Note     bool   `long:"note" description:"show the Z-note the file belongs to"`
+	Open     bool   `long:"open" description:"show the open command of the file's Z-note"`
+	View     bool   `long:"view" description:"show the view command of the file's Z-note"`
+	Format   string `long:"format" choice:"tsv" choice:"null-separated" choice:"json" choice:"ndjson" default:"tsv" description:"Output format: escaped tab-separated lines, NUL-terminated fields (a file being as many fields as columns are selected, in the order of the flags above), a JSON array or a JSON object per line (the JSON formats always include every field)"`
+	MaxDepth int    `long:"max-depth" description:"Look at most this many levels deep into Ks (default: settings.max-depth, or unlimited)"`
+}
+
+// fileEntry is a single file as listed by enumerate-files.
+type fileEntry struct {
+	K        string    `json:"k"`
+	File     string    `json:"file"` // relative to the K
+	Type     string    `json:"type"`
+	FullPath string    `json:"full_path"`
+	MTime    time.Time `json:"mtime,omitzero"`
+	Size     int64     `json:"size"`
+	Note     string    `json:"note,omitempty"` // relative to the K
+	Open     string    `json:"open,omitempty"`
+	View     string    `json:"view,omitempty"`
 }
 
 func (c *EnumerateFilesCommand) Execute(_ []string) error {
@@ -23,125 +49,147 @@ func (c *EnumerateFilesCommand) Execute(_ []string) error {
 }
 
 func (c *EnumerateFilesCommand) enumerateFiles(w io.Writer) error {
-	for id, k := range cfg.GlobalCfg.Ks {
-		entries, err := os.ReadDir(k.Path)
-		if err != nil {
-			return fmt.Errorf("unable to read dir '%s' for K '%s'", k.Path, id)
+	addEnabled := func(e fileEntry) []string {
+		result := []string{}
+		if c.K {
+			result = append(result, e.K)
 		}
-		partsSep := "\t"
-
-		addEnabled := func(k, fileName, fileType, fullPath string) []string {
-			result := []string{}
-			if c.K {
-				result = append(result, k)
-			}
-			if c.FileName {
-				result = append(result, fileName)
-			}
-			if c.FileType {
-				result = append(result, fileType)
-			}
-			if c.FullPath {
-				result = append(result, fullPath)
+		if c.FileName {
+			result = append(result, e.File)
+		}
+		if c.FileType {
+			result = append(result, e.Type)
+		}
+		if c.FullPath {
+			result = append(result, e.FullPath)
+		}
+		if c.MTime {
+			mtime := ""
+			if !e.MTime.IsZero() {
+				mtime = e.MTime.Format(time.RFC3339)
 			}
-			return result
+			result = append(result, mtime)
 		}
-		writeResult := func(b []byte) error {
-			var err error
-			_, writeErr := w.Write(b)
-			if writeErr != nil {
-				err = writeErr
+		if c.Size {
+			result = append(result, strconv.FormatInt(e.Size, 10))
+		}
+		if c.Note {
+			result = append(result, e.Note)
+		}
+		if c.Open {
+			result = append(result, e.Open)
+		}
+		if c.View {
+			result = append(result, e.View)
+		}
+		return result
+	}
+
+	write := func(data []byte) {
+		if _, err := w.Write(data); err != nil {
+			log.Warn().Err(err).Msg("error writing result")
+		}
+	}
+
+	notes := map[string]*cfg.Z{}
+	entries := []fileEntry{}
+	err := c.enumerate(c.MaxDepth, func(k, fileName, fileType, fullPath string) error {
+		e := c.entryOf(k, fileName, fileType, fullPath, notes)
+		switch c.Format {
+		case "json":
+			entries = append(entries, e)
+		case "ndjson":
+			data, err := json.Marshal(e)
+			if err != nil {
+				return fmt.Errorf("unable to marshal entry (%s)", err.Error())
 			}
-			_, writeErr = w.Write([]byte{'\n'})
-			if writeErr != nil {
-				err = writeErr
+			write(append(data, '\n'))
+		case "null-separated":
+			// every field is terminated by a NUL, so anything may be in them;
+			// the records are told apart by their fixed number of fields, like
+			// those of 'git status -z'
+			write([]byte(strings.Join(addEnabled(e), "\x00") + "\x00"))
+		default:
+			fields := addEnabled(e)
+			for i := range fields {
+				fields[i] = tsvEscape(fields[i])
 			}
-			return err
+			write([]byte(strings.Join(fields, "\t") + "\n"))
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if c.Format == "json" {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("unable to marshal entries (%s)", err.Error())
+		}
+		write(append(data, '\n'))
+	}
+	return nil
+}
 
-		for i := range entries {
-			if entries[i].Name()[0] == '.' {
-				continue
-			}
-			if entries[i].Type().IsDir() {
-				dir := entries[i].Name()
-				dirEntries, err := os.ReadDir(path.Join(k.Path, dir))
-				if err != nil {
-					log.Warn().Str("dir", dir).Msg("could not open dir for reading")
-				} else {
-					hasZ := func() bool {
-						for _, e := range dirEntries {
-							if e.Name() == ".z" {
-								return true
-							}
-						}
-						return false
-					}()
+// entryOf gathers the details of a file, reading the Z-note it belongs to
+// once per note.
+func (c *configured) entryOf(kID, fileName, fileType, fullPath string, notes map[string]*cfg.Z) fileEntry {
+	e := fileEntry{K: kID, File: fileName, Type: fileType, FullPath: fullPath}
+	if info, err := os.Stat(fullPath); err == nil {
+		e.MTime, e.Size = info.ModTime(), info.Size()
+	}
 
-					if hasZ {
-						err := writeResult([]byte(
-							strings.Join(
-								addEnabled(id, dir, "Z", path.Join(k.Path, dir)),
-								partsSep,
-							),
-						))
-						if err != nil {
-							log.Warn().Err(err).Msg("error writing result")
-						}
-						z, err := cfg.ReadZ(path.Join(k.Path, dir))
-						if err != nil {
-							return fmt.Errorf("unable to get z-data from dir (%s)", err.Error())
-						}
-						for _, source := range z.Sources {
-							err := writeResult([]byte(
-								strings.Join(
-									addEnabled(id, path.Join(dir, source), "S", path.Join(k.Path, dir, source)),
-									partsSep,
-								),
-							))
-							if err != nil {
-								log.Warn().Err(err).Msg("error writing result")
-							}
-						}
-						for _, object := range z.Objects {
-							err := writeResult([]byte(
-								strings.Join(
-									addEnabled(id, path.Join(dir, object), "O", path.Join(k.Path, dir, object)),
-									partsSep,
-								),
-							))
-							if err != nil {
-								log.Warn().Err(err).Msg("error writing result")
-							}
-						}
-					} else {
-						for _, e := range dirEntries {
-							if e.Name()[0] == '.' {
-								continue
-							}
-							err := writeResult([]byte(
-								strings.Join(
-									addEnabled(id, path.Join(dir, e.Name()), "F", path.Join(k.Path, dir, e.Name())),
-									partsSep,
-								),
-							))
-							if err != nil {
-								log.Warn().Err(err).Msg("error writing result")
-							}
-						}
-					}
-				}
-			} else {
-				err := writeResult([]byte(
-					strings.Join(
-						addEnabled(id, entries[i].Name(), "F", path.Join(k.Path, entries[i].Name())),
-						partsSep,
-					),
-				))
-				if err != nil {
-					log.Warn().Err(err).Msg("error writing result")
-				}
-			}
+	kPath := c.config.Ks[kID].Path
+	dir := fileName
+	if fileType != "Z" {
+		dir = path.Dir(fileName)
+	}
+	note, ok := cfg.NoteOf(kPath, dir)
+	if !ok {
+		return e
+	}
+	e.Note = note
+	key := path.Join(kID, note)
+	z, ok := notes[key]
+	if !ok {
+		var err error
+		if z, err = cfg.ReadZ(path.Join(kPath, note)); err != nil {
+			log.Warn().Err(err).Str("note", note).Msg("could not read Z-note")
+		}
+		notes[key] = z
+	}
+	if z != nil {
+		e.Open, e.View = z.Open, z.View
+	}
+	return e
+}
+
+// enumerate calls fn for every file of every K, with the file's path
+// relative to the K, its Z-type and its full path, looking at most maxDepth
+// levels deep (0 for the configured depth).
+func (c *configured) enumerate(maxDepth int, fn func(k, fileName, fileType, fullPath string) error) error {
+	if maxDepth == 0 {
+		maxDepth = c.config.Settings.MaxDepth
+	}
+	ids := make([]string, 0, len(c.config.Ks))
+	for id := range c.config.Ks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		k := c.config.Ks[id]
+		var fnErr error
+		err := cfg.WalkK(k.Path, maxDepth, c.config.Ignore(k), false, func(rel, zType string) error {
+			fnErr = fn(id, rel, zType, path.Join(k.Path, rel))
+			return fnErr
+		})
+		if fnErr != nil {
+			return fnErr
+		}
+		if err != nil {
+			// one K that cannot be read should not hide the others
+			log.Warn().Err(err).Str("K", id).Str("path", k.Path).Msg("could not walk K, skipping")
 		}
 	}
 
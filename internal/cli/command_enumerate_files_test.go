@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"z/internal/cfg"
+)
+
+// configuredK returns a config holding a single K 'k' with a Z-note and a
+// file with a tab and a line break in its name.
+func configuredK(t *testing.T) (string, configured) {
+	t.Helper()
+	k := t.TempDir()
+	for _, f := range []string{"note/main.tex", "odd\tname\n.md"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(k, f)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(k, f), []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cfg.WriteZ(filepath.Join(k, "note"), cfg.Z{Open: "edit main.tex", Sources: []string{"main.tex"}}); err != nil {
+		t.Fatal(err)
+	}
+	return k, configured{&cfg.Cfg{Ks: map[string]cfg.K{"k": {Path: k}}}}
+}
+
+func TestEnumerateFilesFormats(t *testing.T) {
+	k, config := configuredK(t)
+	run := func(c EnumerateFilesCommand) string {
+		t.Helper()
+		c.configured = config
+		out := bytes.Buffer{}
+		if err := c.enumerateFiles(&out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	got := run(EnumerateFilesCommand{K: true, FileName: true, FileType: true, Note: true, Open: true, Format: "tsv"})
+	want := "k\tnote\tZ\tnote\tedit main.tex\n" +
+		"k\tnote/main.tex\tS\tnote\tedit main.tex\n" +
+		"k\todd\\tname\\n.md\tF\t\t\n"
+	if got != want {
+		t.Errorf("tsv output is %q, want %q", got, want)
+	}
+
+	got = run(EnumerateFilesCommand{FileName: true, FileType: true, Format: "null-separated"})
+	want = "note\x00Z\x00note/main.tex\x00S\x00odd\tname\n.md\x00F\x00"
+	if got != want {
+		t.Errorf("null-separated output is %q, want %q", got, want)
+	}
+
+	var entries []fileEntry
+	if err := json.Unmarshal([]byte(run(EnumerateFilesCommand{Format: "json"})), &entries); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(run(EnumerateFilesCommand{Format: "ndjson"}), "\n"), "\n")
+	if len(entries) != 3 || len(lines) != 3 {
+		t.Fatalf("json has %d entries and ndjson %d lines, want 3 each", len(entries), len(lines))
+	}
+	for i, line := range lines {
+		e := fileEntry{}
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(e, entries[i]) {
+			t.Errorf("ndjson entry %d is %+v, but %+v in json", i, e, entries[i])
+		}
+	}
+	e := entries[1]
+	if e.MTime.IsZero() || e.Size != int64(len("content")) {
+		t.Errorf("entry %+v lacks the file's mtime or size", e)
+	}
+	e.MTime, e.Size = time.Time{}, 0
+	want2 := fileEntry{K: "k", File: "note/main.tex", Type: "S", FullPath: filepath.Join(k, "note", "main.tex"), Note: "note", Open: "edit main.tex"}
+	if e != want2 {
+		t.Errorf("json entry is %+v, want %+v", e, want2)
+	}
+}
@@ -2,186 +2,350 @@ package cli
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"z/internal/cfg"
+	"z/internal/search"
 
 	"github.com/rs/zerolog/log"
 )
 
 type FindCommand struct {
 	T    FindTextCommand `command:"t" description:"Search for text content within files (short for 'text')"`
-	Text FindTextCommand `command:"text" description:"Search for text content within files using ripgrep and fzf"`
+	Text FindTextCommand `command:"text" description:"Search for text content within files using the full-text index and fzf"`
 	F    FindFileCommand `command:"f" description:"Find files by name (short for 'file')"`
 	File FindFileCommand `command:"file" description:"Find files by name using fzf with preview"`
 }
 
-type FindTextCommand struct{}
+// findOpts are the options shared by the find commands. Without a query,
+// the matches are picked from interactively and the pick is opened.
+type findOpts struct {
+	Query  string `short:"q" long:"query" description:"Print the matches for the query, best first, instead of picking one interactively"`
+	Limit  int    `short:"n" long:"limit" description:"Print at most this many matches (default: all)"`
+	Format string `long:"format" choice:"plain" choice:"json" choice:"tsv" default:"plain" description:"Format to print matches in"`
+}
+
+// findResult is a single match of a find command.
+type findResult struct {
+	K       string  `json:"k"`
+	File    string  `json:"file"` // relative to the K
+	Type    string  `json:"type"`
+	Line    int     `json:"line,omitempty"`
+	Page    int     `json:"page,omitempty"` // for text found in documents like PDFs
+	Snippet string  `json:"snippet,omitempty"`
+	Score   float64 `json:"-"`
+
+	fullPath string
+}
+
+type FindTextCommand struct {
+	configured
+
+	findOpts
+}
 
 func (c *FindTextCommand) Execute(_ []string) error {
 
-	// TODO(ja-he): Add PDFs (to-text-converted), perhaps others, perhaps behind flag?
-
-	pathsArg := ""
-	sedConvertKToPathPipeline := ""
-	sedConvertPathToKCommandStr := ""
-	for kID, k := range cfg.GlobalCfg.Ks {
-		pathsArg += fmt.Sprintf(` "%s"`, k.Path)
-		sedConvertKToPathPipeline += fmt.Sprintf(
-			`| sed "s/^%s /%s\//"`,
-			kID,
-			strings.ReplaceAll(k.Path, `/`, `\/`),
-		)
-		sedConvertPathToKCommandStr += fmt.Sprintf(
-			`| sed "s/^%s\//%s /"`,
-			strings.ReplaceAll(k.Path, `/`, `\/`),
-			kID,
-		)
-	}
-
-	rgCommandStr := `rg --line-number --with-filename . --color=never --field-match-separator ' '` + pathsArg + " "
-	sourceCommandStr := rgCommandStr + sedConvertPathToKCommandStr
-	fzfOptsStr := "--ansi --preview " +
-		fmt.Sprintf(
-			`'bat --color=always --decorations=never $(echo {1..2} %s) --highlight-line {3}'`,
-			sedConvertKToPathPipeline,
-		)
-	fzfCommandStr := "fzf " + fzfOptsStr
-
-	cmd := exec.Command("bash", "-c", sourceCommandStr+" | "+fzfCommandStr)
-
-	cmd.Stderr, cmd.Stdin = os.Stderr, os.Stdin
-	outPipe, err := cmd.StdoutPipe()
+	results, err := c.findText(c.Query)
+	if err != nil {
+		return err
+	}
+	if c.Query != "" {
+		return c.print(results)
+	}
+
+	// text extracted from documents has no line to highlight, preview it like a found file
+	preview := "if [ {5} -gt 0 ]; then bat --color=always --decorations=never --highlight-line {5} {7}; else z preview {2} {3} {4}; fi"
+	selected, err := pick(results, "2,3,5,6", preview)
 	if err != nil {
-		return fmt.Errorf("cant get stdout pipe (%s)", err.Error())
+		return err
+	}
+	return c.openResults(selected)
+}
+
+// findText searches all Ks' full-text indices, which include the text
+// extracted from documents like PDFs. An empty query matches every line, in
+// order.
+func (c *configured) findText(query string) ([]findResult, error) {
+	ids := make([]string, 0, len(c.config.Ks))
+	for kID := range c.config.Ks {
+		ids = append(ids, kID)
+	}
+	sort.Strings(ids)
+
+	results := []findResult{}
+	for _, kID := range ids {
+		k := c.config.Ks[kID]
+		idx, err := search.Open(kID, k.Path, c.config.Ignore(k))
+		if err != nil {
+			log.Warn().Err(err).Str("K", kID).Msg("could not index K, skipping it")
+			continue
+		}
+		// files often have several matching lines, only classify them once
+		types := map[string]string{}
+		add := func(hit search.Hit) {
+			zt, ok := types[hit.File]
+			if !ok {
+				zt = c.zTypeOf(kID, hit.File)
+				types[hit.File] = zt
+			}
+			results = append(results, findResult{
+				K: kID, File: hit.File, Type: zt, Line: hit.Line, Page: hit.Page, Snippet: hit.Text, Score: hit.Score,
+				fullPath: path.Join(idx.Root, hit.File),
+			})
+		}
+
+		if query == "" {
+			err := idx.Lines(func(hit search.Hit) error {
+				add(hit)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, hit := range idx.Search(query) {
+			add(hit)
+		}
 	}
+	if query != "" {
+		sortResults(results)
+	}
+	return results, nil
+}
 
-	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("error starting bash command (%s)", err.Error())
+// zTypeOf determines the Z-type of a file in a K.
+func (c *configured) zTypeOf(kID, file string) string {
+	k, ok := c.config.Ks[kID]
+	if !ok {
+		return "F"
 	}
-	selected, err := io.ReadAll(outPipe)
+	zType, err := cfg.Classify(k.Path, file)
+	if err != nil {
+		return "F"
+	}
+	return zType
+}
+
+type FindFileCommand struct {
+	configured
+
+	findOpts
+}
+
+func (c *FindFileCommand) Execute(_ []string) error {
+	results, err := c.findFiles(c.Query)
 	if err != nil {
-		return fmt.Errorf("cant read (%s)", err.Error())
+		return err
 	}
-	if err := cmd.Wait(); err != nil {
-		return fmt.Errorf("error waiting on bash command (%s)", err.Error())
+	if c.Query != "" {
+		return c.print(results)
 	}
 
-	selected = bytes.TrimRight(selected, "\n")
-	selectedLinewise := bytes.Split(selected, []byte{'\n'})
+	selected, err := pick(results, "2,3,4", "z preview {2} {3} {4}")
+	if err != nil {
+		return err
+	}
+	return c.openResults(selected)
+}
 
-	switch len(selectedLinewise) {
-	case 0:
-		fmt.Println("nothing selected, exiting...")
+// findFiles matches the query against the paths of all files of all Ks. An
+// empty query matches every file, in order.
+func (c *configured) findFiles(query string) ([]findResult, error) {
+	queryTerms := strings.Fields(strings.ToLower(query))
+	results := []findResult{}
+	err := c.enumerate(0, func(k, fileName, fileType, fullPath string) error {
+		score, ok := matchFile(queryTerms, fileName)
+		if ok {
+			results = append(results, findResult{K: k, File: fileName, Type: fileType, Score: score, fullPath: fullPath})
+		}
 		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not enumerate files (%w)", err)
+	}
+	if query != "" {
+		sortResults(results)
+	}
+	return results, nil
+}
 
-	case 1:
-		tokens := bytes.Split(selectedLinewise[0], []byte{' '})
-		if len(tokens) < 4 {
-			return fmt.Errorf("expected at least 4 tokens to be returned by fzf (got %d)", len(tokens))
-		}
-		kID := string(tokens[0])
-		file := string(tokens[1])
-		zt := func() string {
-			k, ok := cfg.GlobalCfg.Ks[kID]
-			if !ok {
-				return "F"
-			}
-			fullPath := path.Join(k.Path, file)
-			dir, filename := path.Split(fullPath)
-			z, err := cfg.ReadZ(dir)
-			if err != nil {
-				return "F"
+// matchFile tells whether every term occurs in the file's path, scoring
+// matches in the file name itself and shorter paths higher.
+func matchFile(terms []string, file string) (float64, bool) {
+	lower := strings.ToLower(file)
+	base := path.Base(lower)
+	score := 0.0
+	for _, term := range terms {
+		if !strings.Contains(lower, term) {
+			return 0, false
+		}
+		score++
+		if strings.Contains(base, term) {
+			score++
+		}
+		if strings.HasPrefix(base, term) {
+			score++
+		}
+	}
+	return score + 1/float64(len(file)+1), true
+}
+
+// sortResults sorts results best first, and by K, file and line among equals.
+func sortResults(results []findResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.K != b.K {
+			return a.K < b.K
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+}
+
+// print writes the results to stdout in the requested format.
+func (o *findOpts) print(results []findResult) error {
+	if o.Limit > 0 && len(results) > o.Limit {
+		results = results[:o.Limit]
+	}
+	out := bytes.Buffer{}
+	switch o.Format {
+	case "json":
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("unable to marshal results (%s)", err.Error())
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	case "tsv":
+		for _, r := range results {
+			fields := []string{r.K, r.File, r.Type, "", "", r.Snippet}
+			if r.Line > 0 {
+				fields[3] = strconv.Itoa(r.Line)
 			}
-			for _, source := range z.Sources {
-				if source == filename {
-					return "S"
-				}
+			if r.Page > 0 {
+				fields[4] = strconv.Itoa(r.Page)
 			}
-			for _, object := range z.Objects {
-				if object == filename {
-					return "O"
-				}
+			for i := range fields {
+				fields[i] = tsvEscape(fields[i])
 			}
-			return "F"
-		}()
-
-		openCmd := &OpenCommand{}
-		openCmd.Args.K = kID
-		openCmd.Args.File = file
-		openCmd.Args.Type = zt
-		return openCmd.Execute(nil)
-
+			out.WriteString(strings.Join(fields, "\t") + "\n")
+		}
 	default:
-		log.Warn().Msg("unable to open multiple files right now")
-		return nil
+		for _, r := range results {
+			switch {
+			case r.Line > 0:
+				fmt.Fprintf(&out, "%s %s:%d: %s\n", r.K, r.File, r.Line, r.Snippet)
+			case r.Page > 0:
+				fmt.Fprintf(&out, "%s %s (p. %d): %s\n", r.K, r.File, r.Page, r.Snippet)
+			case r.Snippet != "":
+				fmt.Fprintf(&out, "%s %s: %s\n", r.K, r.File, r.Snippet)
+			default:
+				fmt.Fprintf(&out, "%s %s (%s)\n", r.K, r.File, r.Type)
+			}
+		}
 	}
+	_, err := os.Stdout.Write(out.Bytes())
+	return err
 }
 
-type FindFileCommand struct{}
+// tsvEscape escapes the characters that would break a TSV field.
+func tsvEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
 
-func (c *FindFileCommand) Execute(_ []string) error {
+// tsvUnescape reverses tsvEscape.
+func tsvUnescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\r`, "\r").Replace(s)
+}
 
-	fzfCmd := exec.Command("fzf", "--preview", "z preview {}")
+// pick lets the user pick any number of results with fzf. Each result is handed to
+// fzf as the fields '<index>\t<K>\t<file>\t<type>\t<line>\t<snippet>\t<full
+// path>	<page>'; withNth selects the fields shown and preview may refer to
+// any.
+func pick(results []findResult, withNth, preview string) ([]findResult, error) {
+	fzfCmd := exec.Command("fzf", "--multi", "--delimiter", "\t", "--with-nth", withNth, "--preview", preview)
 	fzfCmd.Stderr = os.Stderr
 	resultsWriter, err := fzfCmd.StdinPipe()
 	if err != nil {
-		return fmt.Errorf("could not open stdin pipe for fzf (%s)", err.Error())
+		return nil, fmt.Errorf("could not open stdin pipe for fzf (%s)", err.Error())
 	}
 	stdoutPipe, err := fzfCmd.StdoutPipe()
 	if err != nil {
-		return fmt.Errorf("could not open stdout pipe for fzf (%s)", err.Error())
-	}
-	enumerationErr := (&EnumerateFilesCommand{
-		K:        true,
-		FileName: true,
-		FileType: true,
-		FullPath: false,
-	}).enumerateFiles(resultsWriter)
-	if enumerationErr != nil {
-		return fmt.Errorf("could not enumerate files (%w)", enumerationErr)
+		return nil, fmt.Errorf("could not open stdout pipe for fzf (%s)", err.Error())
 	}
 
 	if err := fzfCmd.Start(); err != nil {
-		return fmt.Errorf("could not start fzf (%s)", err.Error())
+		return nil, fmt.Errorf("could not start fzf (%s)", err.Error())
 	}
+	go func() {
+		defer func() { _ = resultsWriter.Close() }()
+		for i, r := range results {
+			line := fmt.Sprintf("%d\t%s\t%s\t%s\t%d\t%s\t%s\t%d\n",
+				i, r.K, r.File, r.Type, r.Line, strings.ReplaceAll(r.Snippet, "\t", " "), r.fullPath, r.Page)
+			if _, err := io.WriteString(resultsWriter, line); err != nil {
+				// fzf exited before reading everything, nothing left to do
+				return
+			}
+		}
+	}()
 
 	selected, err := io.ReadAll(stdoutPipe)
 	if err != nil {
 		if fzfTermErr := fzfCmd.Process.Signal(syscall.SIGTERM); fzfTermErr != nil {
-			return fmt.Errorf("could not read fzf output (%w) and then failed to shut down FZF (%w)", err, fzfTermErr)
+			return nil, fmt.Errorf("could not read fzf output (%w) and then failed to shut down FZF (%w)", err, fzfTermErr)
 		}
-		return fmt.Errorf("could not read fzf output (%s)", err.Error())
+		return nil, fmt.Errorf("could not read fzf output (%s)", err.Error())
 	}
 
 	if err := fzfCmd.Wait(); err != nil {
-		return fmt.Errorf("could not wait for fzf to complete (%s)", err.Error())
+		return nil, fmt.Errorf("could not wait for fzf to complete (%s)", err.Error())
 	}
 
-	selected = bytes.TrimRight(selected, "\n")
-	selectedLinewise := bytes.Split(selected, []byte{'\n'})
+	picked := []findResult{}
+	for _, line := range strings.Split(strings.TrimRight(string(selected), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		i, err := strconv.Atoi(strings.SplitN(line, "\t", 2)[0])
+		if err != nil || i < 0 || i >= len(results) {
+			return nil, fmt.Errorf("unexpected line returned by fzf: '%s'", line)
+		}
+		picked = append(picked, results[i])
+	}
+	return picked, nil
+}
 
-	switch len(selectedLinewise) {
+// openResults opens the picked results.
+func (c *configured) openResults(results []findResult) error {
+	switch len(results) {
 	case 0:
 		fmt.Println("nothing selected, exiting...")
 		return nil
 
 	case 1:
-		line := string(selectedLinewise[0])
-		args := strings.Split(line, "\t")
-		openCmd := &OpenCommand{}
-		openCmd.Args.K = args[0]
-		openCmd.Args.File = args[1]
-		openCmd.Args.Type = args[2]
+		openCmd := &OpenCommand{configured: configured{c.config}}
+		openCmd.Args.K = results[0].K
+		openCmd.Args.File = results[0].File
+		openCmd.Args.Type = results[0].Type
+		openCmd.Page, openCmd.Line = results[0].Page, results[0].Line
 		return openCmd.Execute(nil)
 
 	default:
-		log.Warn().Msg("unable to open multiple files right now")
-		return nil
+		return c.openBatch(results)
 	}
 }
@@ -13,15 +13,13 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-type InitCommand struct{}
+type InitCommand struct {
+	configured
+}
 
-func (*InitCommand) Execute(_ []string) error {
+func (c *InitCommand) Execute(_ []string) error {
 	// Check if config file exists, create boilerplate if not
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("could not determine user home directory: %w", err)
-	}
-	configPath := path.Join(homeDir, ".config/z.yml")
+	configPath := c.config.Path
 	if _, err := os.Stat(configPath); errors.Is(err, fs.ErrNotExist) {
 		log.Info().Str("path", configPath).Msg("config file not found, creating boilerplate config")
 
@@ -31,32 +29,18 @@ func (*InitCommand) Execute(_ []string) error {
 
 		log.Info().Str("path", configPath).Msg("created boilerplate config")
 
-		// Reload the config
-		configData, err := os.ReadFile(configPath)
+		// Reload the config, along with any overlay already in place
+		config, err := cfg.Load(configPath)
 		if err != nil {
 			return fmt.Errorf("failed to read newly created config: %w", err)
 		}
-
-		config := cfg.Cfg{}
-		if err := yaml.Unmarshal(configData, &config); err != nil {
-			return fmt.Errorf("failed to parse newly created config: %w", err)
-		}
-
-		// Expand environment variables in paths
-		for id, k := range config.Ks {
-			config.Ks[id] = cfg.K{
-				Path: os.ExpandEnv(k.Path),
-				URL:  os.ExpandEnv(k.URL),
-			}
-		}
-
-		cfg.GlobalCfg = config
+		c.config = config
 	}
 
 	log.Info().Msg("initializing Ks")
 
-	config := cfg.GlobalCfg
-	log.Debug().Interface("config", config).Msg("using global config")
+	config := c.config
+	log.Debug().Interface("config", config).Msg("using config")
 
 	if len(config.Ks) == 0 {
 		log.Warn().Msg("no Ks configured")
@@ -1,29 +1,96 @@
 package cli
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"os/exec"
 	"path"
-	"strings"
 	"z/internal/cfg"
+	"z/internal/opener"
+	"z/internal/sniff"
 
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
 
+// OpenCommand opens a file of a K, given either as K and path relative to it,
+// or as a plain path, from which the K is resolved. Without arguments, it
+// opens the Z-note the working directory is in.
 type OpenCommand struct {
+	configured
+
 	Args struct {
-		K    string `positional-arg-name:"K" required:"yes" description:"Knowledge base ID"`
-		File string `positional-arg-name:"file" required:"yes" description:"Path to file relative to K"`
-		Type string `positional-arg-name:"type" required:"yes" description:"Type: Z (Z-note), D (directory), F (file), S (source), O (object)"`
+		K    string `positional-arg-name:"K" description:"Knowledge base ID, or a path to open (absolute or relative to the working directory)"`
+		File string `positional-arg-name:"file" description:"Path to file relative to K"`
+		Type string `positional-arg-name:"type" description:"Type: Z (Z-note), D (directory), F (file), S (source), O (object) (default: detected)"`
 	} `positional-args:"yes"`
+	Page   int `long:"page" description:"Page to open a document (e.g., a PDF) at"`
+	Line   int `long:"line" description:"Line to open a text file at"`
+	Column int `long:"column" description:"Column to open a text file at (with --line)"`
+
+	noPost bool // leave running the post hooks to the caller, e.g. when opening a batch
+}
+
+// resolveArgs normalizes the arguments to K, path relative to it and
+// (possibly empty) type, resolving the K from a plain path or the working
+// directory.
+func (c *OpenCommand) resolveArgs() error {
+	isType := func(s string) bool {
+		switch s {
+		case "Z", "D", "F", "S", "O":
+			return true
+		}
+		return false
+	}
+
+	target := ""
+	switch {
+	case c.Args.K == "":
+		cwd, err := os.Getwd()
+		if err != nil {
+			return fmt.Errorf("could not determine working directory (%s)", err.Error())
+		}
+		target = cwd
+	case c.Args.File == "":
+		if _, ok := c.config.Ks[c.Args.K]; ok {
+			if _, err := os.Stat(c.Args.K); err != nil {
+				// just a K, open its root
+				c.Args.File = "."
+				return nil
+			}
+		}
+		target = c.Args.K
+	case c.Args.Type == "" && isType(c.Args.File):
+		if _, ok := c.config.Ks[c.Args.K]; ok {
+			return nil
+		}
+		target, c.Args.Type = c.Args.K, c.Args.File
+	default:
+		return nil
+	}
+
+	kID, rel, err := c.config.KOf(target)
+	if err != nil {
+		return err
+	}
+	if c.Args.K == "" {
+		// from within a note, open the note itself
+		if note, ok := cfg.NoteOf(c.config.Ks[kID].Path, rel); ok {
+			rel, c.Args.Type = note, "Z"
+		}
+	}
+	log.Debug().Str("path", target).Str("K", kID).Str("file", rel).Msg("resolved K of path")
+	c.Args.K, c.Args.File = kID, rel
+	return nil
 }
 
 func (c *OpenCommand) Execute(_ []string) error {
+	if err := c.resolveArgs(); err != nil {
+		return err
+	}
+
 	kID := c.Args.K
-	k, ok := cfg.GlobalCfg.Ks[kID]
+	k, ok := c.config.Ks[kID]
 	if !ok {
 		return fmt.Errorf("no such K '%s'", kID)
 	}
@@ -39,6 +106,13 @@ func (c *OpenCommand) Execute(_ []string) error {
 	}
 
 	zType := c.Args.Type
+	if zType == "" {
+		zType, err = cfg.Classify(k.Path, file)
+		if err != nil {
+			return fmt.Errorf("could not determine Z-type of '%s' (%s)", file, err.Error())
+		}
+		log.Debug().Str("file", file).Str("type", zType).Msg("detected Z-type")
+	}
 
 	switch zType {
 	case "Z":
@@ -76,90 +150,52 @@ func (c *OpenCommand) Execute(_ []string) error {
 		if err := openCmd.Run(); err != nil {
 			return fmt.Errorf("could not run open command from '%s' (%s)", zPath, err.Error())
 		}
-		for i, post := range z.Post {
-			postCmd := exec.Command("bash", "-c", fmt.Sprintf("cd '%s' ; %s", fullPath, post))
-			log.Info().Int("i", i).Str("command", postCmd.String()).Msg("running post command:")
-			postCmd.Stdout, postCmd.Stderr, postCmd.Stdin = os.Stdout, os.Stderr, os.Stdin
-			if err := postCmd.Run(); err != nil {
-				return fmt.Errorf("unable to run post command %d from '%s' (%s)", i, zPath, err.Error())
-			}
+		if c.noPost {
+			return nil
 		}
-		return nil
+		return runPostHooks(fullPath)
 
 	case "D":
-		return fmt.Errorf("TODO: open regular dir")
+		return c.openDir(kID, k, file, fullPath)
 
 	case "F", "S", "O":
-		ext := strings.TrimLeft(path.Ext(fullPath), ".")
-		openCmd, err := func() (*exec.Cmd, error) {
-			switch ext {
-			case "md", "txt", "tex":
-				nvimCmd := exec.Command("nvim", fullPath)
-				return nvimCmd, nil
-
-			case "png", "jpg", "jpeg", "tif":
-				openCmd := exec.Command(
-					"feh",
-					"--image-bg=white",
-					fullPath,
-				)
-				return openCmd, nil
-
-			case "pdf":
-				openCmd := exec.Command("zathura", fullPath)
-				return openCmd, nil
-
-			case "html":
-				openCmd := exec.Command("firefox", fullPath)
-				return openCmd, nil
-
-			case "xopp":
-				openCmd := exec.Command("xournalpp", fullPath)
-				return openCmd, nil
-
+		fileType, err := sniff.File(fullPath)
+		if err != nil {
+			return fmt.Errorf("could not determine type of '%s' (%s)", fullPath, err.Error())
+		}
+		registry := opener.New(c.config.Openers)
+		o, ok := registry.Opener(fullPath, fileType)
+		if !ok {
+			response, err := prompt(fmt.Sprintf("no opener for %s file '%s', try 'nvim'? [Y/n]", fileType.Class, path.Base(fullPath)))
+			if err != nil {
+				return fmt.Errorf("on %s file without opener, %s", fileType.Class, err.Error())
+			}
+			switch response {
+			case "", "y", "Y", "yes":
+				o = cfg.Opener{Open: "nvim {{quote .Path}}"}
+			case "n", "N", "no":
+				return fmt.Errorf("user rejected suggested editor for %s file", fileType.Class)
 			default:
-				fmt.Printf("unknown file extension '%s', try 'nvim'? [Y/n]", ext)
-				r := bufio.NewReader(os.Stdin)
-				resp, _, err := r.ReadLine()
-				response := string(resp)
-				if err != nil {
-					return nil, fmt.Errorf("on unknown extension '%s', could not get user input (%s)", ext, err.Error())
-				}
-				switch response {
-				case "", "y", "Y", "yes":
-					return exec.Command("nvim", fullPath), nil
-				case "n", "N", "no":
-					return nil, fmt.Errorf("user rejected suggested editor for unknown extensions '%s'", ext)
-				default:
-					return nil, fmt.Errorf("unknown file extension '%s' and unknown response '%s' to prompt", ext, response)
-				}
+				return fmt.Errorf("no opener for %s file and unknown response '%s' to prompt", fileType.Class, response)
 			}
-		}()
-		if err != nil {
-			return fmt.Errorf("error creating command (%s)", err.Error())
 		}
 
-		switch openCmd.Args[0] {
-		case "feh", "zathura", "xournalpp":
-		default:
+		data := opener.DataFor(fullPath, fileType)
+		data.Page, data.Line, data.Column = c.Page, c.Line, c.Column
+		openCmd, err := opener.Command(o.Open, data)
+		if err != nil {
+			return fmt.Errorf("error creating command (%s)", err.Error())
 		}
-		openCmd.Stdout, openCmd.Stderr, openCmd.Stdin = os.Stdout, os.Stderr, os.Stdin
-		if err := openCmd.Run(); err != nil {
+		log.Debug().Str("command", openCmd.String()).Bool("detach", o.Detach).Msg("running open command")
+		if err := opener.Run(openCmd, o.Detach); err != nil {
 			return fmt.Errorf("open command error (%s)", err.Error())
 		}
-		if zType == "S" {
-			dir, _ := path.Split(fullPath)
-			z, err := cfg.ReadZ(dir)
-			if err != nil {
-				return fmt.Errorf("unable to read .z/z.yml to do post hooks (%s)", err.Error())
-			}
-			for i, post := range z.Post {
-				postCmd := exec.Command("bash", "-c", fmt.Sprintf("cd '%s' ; %s", dir, post))
-				postCmd.Stdout, postCmd.Stderr, postCmd.Stdin = os.Stdout, os.Stderr, os.Stdin
-				if err := postCmd.Run(); err != nil {
-					return fmt.Errorf("unable to run post command %d (%s)", i, err.Error())
-				}
+		if zType == "S" && !c.noPost {
+			note, ok := cfg.NoteOf(k.Path, path.Dir(file))
+			if !ok {
+				return fmt.Errorf("no Z-note containing source '%s' to run post hooks of", file)
 			}
+			return runPostHooks(path.Join(k.Path, note))
 		}
 
 	default:
@@ -168,3 +204,20 @@ func (c *OpenCommand) Execute(_ []string) error {
 
 	return nil
 }
+
+// runPostHooks runs the post hooks of the Z-note in dir.
+func runPostHooks(dir string) error {
+	z, err := cfg.ReadZ(dir)
+	if err != nil {
+		return fmt.Errorf("unable to read .z/z.yml to do post hooks (%s)", err.Error())
+	}
+	for i, post := range z.Post {
+		postCmd := exec.Command("bash", "-c", fmt.Sprintf("cd '%s' ; %s", dir, post))
+		log.Info().Int("i", i).Str("command", postCmd.String()).Msg("running post command:")
+		postCmd.Stdout, postCmd.Stderr, postCmd.Stdin = os.Stdout, os.Stderr, os.Stdin
+		if err := postCmd.Run(); err != nil {
+			return fmt.Errorf("unable to run post command %d from '%s' (%s)", i, dir, err.Error())
+		}
+	}
+	return nil
+}
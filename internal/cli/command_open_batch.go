@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"fmt"
+	"path"
+
+	"z/internal/cfg"
+	"z/internal/opener"
+	"z/internal/sniff"
+
+	"github.com/rs/zerolog/log"
+)
+
+// openGroup is a number of files opened by the same opener.
+type openGroup struct {
+	opener  cfg.Opener
+	files   []string
+	types   []sniff.Type
+	results []findResult
+}
+
+// openBatch opens several results at once. Files sharing an opener are
+// opened together, in a single invocation if the opener takes batches; Z-notes,
+// directories and files without an opener are opened one after another. The
+// post hooks of all Z-notes affected run once each, at the end.
+func (c *configured) openBatch(results []findResult) error {
+	registry := opener.New(c.config.Openers)
+	groups := []*openGroup{}
+	byOpen := map[string]*openGroup{}
+	sequence := []findResult{}
+	notes := []string{}
+	affected := map[string]bool{}
+	affect := func(note string) {
+		if !affected[note] {
+			affected[note] = true
+			notes = append(notes, note)
+		}
+	}
+
+	for _, r := range results {
+		k, ok := c.config.Ks[r.K]
+		if !ok {
+			return fmt.Errorf("no such K '%s'", r.K)
+		}
+		switch r.Type {
+		case "Z":
+			affect(r.fullPath)
+			sequence = append(sequence, r)
+			continue
+		case "D":
+			sequence = append(sequence, r)
+			continue
+		case "S":
+			if note, ok := cfg.NoteOf(k.Path, path.Dir(r.File)); ok {
+				affect(path.Join(k.Path, note))
+			}
+		}
+
+		fileType, err := sniff.File(r.fullPath)
+		if err != nil {
+			return fmt.Errorf("could not determine type of '%s' (%s)", r.fullPath, err.Error())
+		}
+		o, ok := registry.Opener(r.fullPath, fileType)
+		if !ok {
+			// let the single open ask what to do
+			sequence = append(sequence, r)
+			continue
+		}
+		key := fmt.Sprintf("%t %s", o.Detach, o.Open)
+		group, ok := byOpen[key]
+		if !ok {
+			group = &openGroup{opener: o}
+			byOpen[key] = group
+			groups = append(groups, group)
+		}
+		group.files = append(group.files, r.fullPath)
+		group.types = append(group.types, fileType)
+		group.results = append(group.results, r)
+	}
+
+	for _, group := range groups {
+		if err := group.open(); err != nil {
+			return err
+		}
+	}
+	for _, r := range sequence {
+		openCmd := &OpenCommand{configured: configured{c.config}, noPost: true}
+		openCmd.Args.K = r.K
+		openCmd.Args.File = r.File
+		openCmd.Args.Type = r.Type
+		openCmd.Page, openCmd.Line = r.Page, r.Line
+		if err := openCmd.Execute(nil); err != nil {
+			return err
+		}
+	}
+	for _, note := range notes {
+		if err := runPostHooks(note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open opens the group's files, all at once if the opener takes batches.
+func (g *openGroup) open() error {
+	data := []opener.Data{}
+	if g.opener.Batch {
+		d := opener.DataFor(g.files[0], g.types[0])
+		d.Paths = g.files
+		// a batch opens at the first file, which may still have a position
+		d.Line = g.results[0].Line
+		if len(g.files) == 1 {
+			d.Page = g.results[0].Page
+		}
+		data = append(data, d)
+	} else {
+		for i, file := range g.files {
+			d := opener.DataFor(file, g.types[i])
+			d.Page, d.Line = g.results[i].Page, g.results[i].Line
+			data = append(data, d)
+		}
+	}
+	for _, d := range data {
+		openCmd, err := opener.Command(g.opener.Open, d)
+		if err != nil {
+			return fmt.Errorf("error creating command (%s)", err.Error())
+		}
+		log.Debug().Str("command", openCmd.String()).Bool("detach", g.opener.Detach).Int("files", len(d.Paths)).Msg("running open command")
+		if err := opener.Run(openCmd, g.opener.Detach); err != nil {
+			return fmt.Errorf("open command error (%s)", err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"z/internal/cfg"
+	"z/internal/opener"
+	"z/internal/sniff"
+
+	"github.com/rs/zerolog/log"
+)
+
+// stdin is shared by all prompts, so that answers piped in are not lost to
+// another reader's buffer.
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt asks the user a question and returns the trimmed answer.
+func prompt(question string) (string, error) {
+	fmt.Print(question)
+	answer, err := stdin.ReadString('\n')
+	if err != nil && (answer == "" || !errors.Is(err, io.EOF)) {
+		return "", fmt.Errorf("could not get user input (%s)", err.Error())
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// openDir opens a plain directory of a K, letting the user choose between
+// opening it with the configured dir-opener, picking one of its files and
+// turning it into a Z-note.
+func (c *OpenCommand) openDir(kID string, k cfg.K, dir, fullPath string) error {
+	choices, def := "[p]ick a file, [z] make it a Z-note, [q]uit", "p"
+	if c.config.Settings.DirOpener != "" {
+		choices, def = "[o]pen, "+choices, "o"
+	}
+	answer, err := prompt(fmt.Sprintf("'%s' is a directory: %s? [%s] ", dir, choices, def))
+	if err != nil {
+		return err
+	}
+	if answer == "" {
+		answer = def
+	}
+
+	switch answer {
+	case "o", "open":
+		if c.config.Settings.DirOpener == "" {
+			return fmt.Errorf("no dir-opener configured (set settings.dir-opener)")
+		}
+		openCmd, err := opener.Command(c.config.Settings.DirOpener, opener.DataFor(fullPath, sniff.Type{}))
+		if err != nil {
+			return fmt.Errorf("error creating dir-opener command (%s)", err.Error())
+		}
+		openCmd.Dir = fullPath
+		if err := opener.Run(openCmd, false); err != nil {
+			return fmt.Errorf("dir-opener command error (%s)", err.Error())
+		}
+		return nil
+	case "p", "pick":
+		return c.pickInDir(kID, dir, fullPath)
+	case "z":
+		return c.makeNote(kID, k, dir, fullPath)
+	case "q", "quit":
+		return nil
+	default:
+		return fmt.Errorf("unknown response '%s' to prompt", answer)
+	}
+}
+
+// pickInDir lets the user pick one of a directory's entries and opens it
+// according to its Z-type.
+func (c *configured) pickInDir(kID, dir, fullPath string) error {
+	entries, err := os.ReadDir(fullPath)
+	if err != nil {
+		return fmt.Errorf("unable to read dir '%s' (%s)", fullPath, err.Error())
+	}
+	results := []findResult{}
+	for _, e := range entries {
+		if e.Name()[0] == '.' {
+			continue
+		}
+		r := findResult{K: kID, File: path.Join(dir, e.Name()), Type: "F", fullPath: path.Join(fullPath, e.Name())}
+		if e.IsDir() {
+			r.Type = "D"
+			if cfg.IsNote(r.fullPath) {
+				r.Type = "Z"
+			}
+		}
+		results = append(results, r)
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("directory '%s' is empty", dir)
+	}
+	selected, err := pick(results, "3,4", "z preview {2} {3} {4}")
+	if err != nil {
+		return err
+	}
+	return c.openResults(selected)
+}
+
+// makeNote turns a plain directory into a Z-note by filling a .z/z.yml (and
+// any of the blueprint's files not there yet) from a blueprint the user
+// chooses, and then opens it.
+func (c *configured) makeNote(kID string, k cfg.K, dir, fullPath string) error {
+	if cfg.IsNote(fullPath) {
+		return fmt.Errorf("'%s' already is a Z-note", dir)
+	}
+
+	ids := []string{}
+	for bID, blueprint := range c.config.Blueprints {
+		if blueprint.Subdir != "" {
+			ids = append(ids, bID)
+		}
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("no blueprints for Z-notes (with a subdir) configured")
+	}
+	slices.Sort(ids)
+	for i, bID := range ids {
+		fmt.Printf("  %d) %s\n", i+1, bID)
+	}
+	answer, err := prompt("blueprint: ")
+	if err != nil {
+		return err
+	}
+	blueprintID := answer
+	if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(ids) {
+		blueprintID = ids[i-1]
+	}
+	blueprint, ok := c.config.Blueprints[blueprintID]
+	if !ok || blueprint.Subdir == "" {
+		return fmt.Errorf("no such blueprint '%s'\nAvailable blueprints: %s", blueprintID, strings.Join(ids, ", "))
+	}
+	if blueprint.Open == "" {
+		return fmt.Errorf("blueprint '%s' is invalid: missing required 'open' command", blueprintID)
+	}
+
+	dd := cfg.TemplateFiller{
+		K:     k,
+		Name:  path.Base(fullPath),
+		Today: strings.Split(time.Now().Local().Format(time.RFC3339), "T")[0],
+		Now:   time.Now().Local().Format(time.RFC3339),
+	}
+	z, err := fillZ(blueprint, dd)
+	if err != nil {
+		return err
+	}
+	for fileTemplate, contentTemplate := range blueprint.Templates {
+		file, err := fillTemplate(fileTemplate, dd)
+		if err != nil {
+			return err
+		}
+		if path.IsAbs(file) {
+			return fmt.Errorf("blueprint file path '%s' is absolute, expected it relative to the note", file)
+		}
+		file = path.Join(fullPath, file)
+		if _, err := os.Stat(file); !errors.Is(err, fs.ErrNotExist) {
+			log.Debug().Str("file", file).Msg("keeping existing file")
+			continue
+		}
+		content, err := fillTemplate(contentTemplate, dd)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			return fmt.Errorf("could not write '%s' (%s)", file, err.Error())
+		}
+		log.Info().Str("file", file).Msg("successfully populated file")
+	}
+	if err := cfg.WriteZ(fullPath, z); err != nil {
+		return fmt.Errorf("unable to create z dir (%s)", err.Error())
+	}
+	log.Info().Str("dir", fullPath).Str("blueprint", blueprintID).Msg("made directory a Z-note")
+
+	openCmd := &OpenCommand{configured: configured{c.config}}
+	openCmd.Args.K = kID
+	openCmd.Args.File = dir
+	openCmd.Args.Type = "Z"
+	return openCmd.Execute(nil)
+}
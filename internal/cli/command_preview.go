@@ -9,26 +9,36 @@ import (
 	"strconv"
 	"strings"
 	"z/internal/cfg"
+	"z/internal/opener"
+	"z/internal/sniff"
 
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
 )
 
 type PreviewCommand struct {
+	configured
 }
 
 func (c *PreviewCommand) Execute(args []string) error {
-	if len(args) != 1 {
-		return fmt.Errorf("expected a single argument for 'preview', got %d\nUsage: z preview '<K>\\t<file>\\t<type>' (tab-separated)", len(args))
-	}
-
-	sArgs := strings.Split(args[0], "\t")
-	if len(sArgs) != 3 {
-		return fmt.Errorf("expected three tab-separated values in argument, got %d\nUsage: z preview '<K>\\t<file>\\t<type>'", len(sArgs))
+	sArgs := args
+	switch len(args) {
+	case 1:
+		sArgs = strings.Split(args[0], "\t")
+		if len(sArgs) != 3 {
+			return fmt.Errorf("expected three tab-separated values in argument, got %d\nUsage: z preview '<K>\\t<file>\\t<type>'", len(sArgs))
+		}
+		// as printed by enumerate-files
+		for i := range sArgs {
+			sArgs[i] = tsvUnescape(sArgs[i])
+		}
+	case 3:
+	default:
+		return fmt.Errorf("expected one or three arguments for 'preview', got %d\nUsage: z preview '<K>\\t<file>\\t<type>' (tab-separated) or z preview <K> <file> <type>", len(args))
 	}
 
 	kID := sArgs[0]
-	k, ok := cfg.GlobalCfg.Ks[kID]
+	k, ok := c.config.Ks[kID]
 	if !ok {
 		return fmt.Errorf("no such K '%s'", kID)
 	}
@@ -45,7 +55,7 @@ func (c *PreviewCommand) Execute(args []string) error {
 
 	zType := sArgs[2]
 
-	termwidth, _, err := func() (int, int, error) {
+	termwidth, termheight, err := func() (int, int, error) {
 		wCmd := exec.Command("tput", "cols")
 		wData, err := wCmd.Output()
 		if err != nil {
@@ -90,23 +100,17 @@ func (c *PreviewCommand) Execute(args []string) error {
 		}
 
 	case "F", "S", "O":
-		ext := path.Ext(file)
+		fileType, err := sniff.File(fullPath)
+		if err != nil {
+			return fmt.Errorf("could not determine type of '%s' (%s)", fullPath, err.Error())
+		}
 		var cmd *exec.Cmd = nil
-		switch strings.TrimPrefix(ext, ".") {
-		case "txt", "md", "tex", "bib":
-			cmd = exec.Command("bat", "--color", "always", "--decorations", "never", fullPath)
-		case "jpeg", "jpg", "png", "tif", "gif":
-			cmd = exec.Command("catimg", "-w", fmt.Sprint(termwidth*2), fullPath)
-		case "pdf":
-			cmd = exec.Command("pdftotext", fullPath, "-")
-		case "html":
-			cmd = exec.Command("w3m", "-dump", fullPath, "-cols", fmt.Sprint(termwidth))
-		default:
-			encodingString, err := exec.Command("file", "-b", fullPath).Output()
-			if err == nil {
-				if strings.Contains(string(encodingString), "UTF-8 text") || strings.Contains(string(encodingString), "ASCII text") {
-					cmd = exec.Command("cat", fullPath)
-				}
+		if o, ok := opener.New(c.config.Openers).Previewer(fullPath, fileType); ok {
+			data := opener.DataFor(fullPath, fileType)
+			data.Width, data.Height = termwidth, termheight
+			cmd, err = opener.Command(o.Preview, data)
+			if err != nil {
+				return fmt.Errorf("error creating preview command (%s)", err.Error())
 			}
 		}
 		if cmd != nil {
@@ -115,7 +119,7 @@ func (c *PreviewCommand) Execute(args []string) error {
 				return fmt.Errorf("error running preview command (%s)", err.Error())
 			}
 		} else {
-			fmt.Printf("file not previewable\n")
+			fmt.Printf("%s file not previewable\n", fileType.Class)
 		}
 
 	default:
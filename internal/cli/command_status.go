@@ -0,0 +1,151 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"z/internal/cfg"
+	"z/internal/gitsync"
+)
+
+// StatusCommand reports the sync state of each K without changing anything.
+type StatusCommand struct {
+	configured
+
+	JSON bool `long:"json" description:"Print the status as JSON"`
+	Args struct {
+		Ks []string `positional-arg-name:"K" description:"IDs of the Ks to report on (default: all)"`
+	} `positional-args:"yes"`
+}
+
+// The states a K can be in, as reported by the status command.
+const (
+	kStateOK        = "ok"
+	kStateMissing   = "missing"    // path does not exist and there is no URL to clone from
+	kStateNotCloned = "not cloned" // path does not exist yet, sync will clone it
+	kStateNotRepo   = "not a repo" // path exists but is not a git working tree
+	kStateError     = "error"
+)
+
+// kStatus is the status of a single K.
+type kStatus struct {
+	K        string                `json:"k"`
+	Path     string                `json:"path"`
+	State    string                `json:"state"`
+	Error    string                `json:"error,omitempty"`
+	Branch   string                `json:"branch,omitempty"`
+	Upstream string                `json:"upstream,omitempty"`
+	Ahead    int                   `json:"ahead"`
+	Behind   int                   `json:"behind"`
+	Dirty    []gitsync.NoteChanges `json:"dirty"`
+}
+
+// Execute runs the status command.
+func (c *StatusCommand) Execute(_ []string) error {
+	ids := make([]string, 0, len(c.config.Ks))
+	for kID := range c.config.Ks {
+		ids = append(ids, kID)
+	}
+	sort.Strings(ids)
+	if len(c.Args.Ks) > 0 {
+		for _, kID := range c.Args.Ks {
+			if _, ok := c.config.Ks[kID]; !ok {
+				return fmt.Errorf("no such K '%s'\nAvailable Ks: %s", kID, strings.Join(ids, ", "))
+			}
+		}
+		ids = c.Args.Ks
+	}
+
+	statuses := make([]kStatus, len(ids))
+	for i, kID := range ids {
+		statuses[i] = c.statusOf(kID, c.config.Ks[kID])
+	}
+
+	if c.JSON {
+		data, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return fmt.Errorf("unable to marshal status (%s)", err.Error())
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	out := bytes.Buffer{}
+	tw := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "K\tSTATE\tBRANCH\tUPSTREAM\tAHEAD\tBEHIND\tDIRTY")
+	for _, s := range statuses {
+		dirty := 0
+		for _, group := range s.Dirty {
+			dirty += len(group.Changes)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%d\t%d\n", s.K, s.State, s.Branch, s.Upstream, s.Ahead, s.Behind, dirty)
+	}
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("unable to format status (%s)", err.Error())
+	}
+	for _, s := range statuses {
+		if s.Error != "" {
+			fmt.Fprintf(&out, "\n%s: %s\n", s.K, s.Error)
+		}
+		if len(s.Dirty) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "\n%s:\n", s.K)
+		for _, group := range s.Dirty {
+			indent := "  "
+			if group.Note != "" {
+				fmt.Fprintf(&out, "  %s/\n", group.Note)
+				indent = "    "
+			}
+			for _, change := range group.Changes {
+				name := change.Path
+				if change.From != "" {
+					name = change.From + " -> " + change.Path
+				}
+				fmt.Fprintf(&out, "%s%s %s\n", indent, change.Code, name)
+			}
+		}
+	}
+	fmt.Print(out.String())
+	return nil
+}
+
+// statusOf determines the status of a single K, without fetching.
+func (c *configured) statusOf(kID string, k cfg.K) kStatus {
+	s := kStatus{K: kID, Path: k.Path, State: kStateOK, Dirty: []gitsync.NoteChanges{}}
+
+	if _, err := os.Stat(k.Path); err != nil {
+		switch {
+		case !errors.Is(err, fs.ErrNotExist):
+			s.State, s.Error = kStateError, err.Error()
+		case k.URL != "":
+			s.State = kStateNotCloned
+		default:
+			s.State = kStateMissing
+		}
+		return s
+	}
+	if _, err := os.Stat(path.Join(k.Path, ".git")); err != nil {
+		s.State = kStateNotRepo
+		return s
+	}
+
+	repo := &gitsync.Repo{Dir: k.Path, Remote: k.Sync.Remote, Branch: k.Sync.Branch, Ignore: c.ignoreFunc(k)}
+	status, err := repo.Status()
+	if err != nil {
+		s.State, s.Error = kStateError, err.Error()
+		return s
+	}
+	s.Branch, s.Upstream = status.Branch, status.Upstream
+	s.Ahead, s.Behind = status.Ahead, status.Behind
+	s.Dirty = gitsync.GroupByNote(k.Path, status.Dirty)
+	return s
+}
@@ -1,119 +1,327 @@
 package cli
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
-	"os/exec"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"text/tabwriter"
 	"time"
 
 	"z/internal/cfg"
+	"z/internal/gitsync"
 
 	"github.com/rs/zerolog/log"
 )
 
+// defaultSyncJobs is the number of Ks synced concurrently, unless configured.
+const defaultSyncJobs = 4
+
 // SyncCommand is the command that syncs all Ks.
-type SyncCommand struct{}
+type SyncCommand struct {
+	configured
+
+	Jobs     int  `short:"j" long:"jobs" description:"Number of Ks to sync concurrently (default: settings.sync-jobs, or 4)"`
+	OnlyPull bool `long:"only-pull" description:"Only pull, don't commit or push local changes"`
+	OnlyPush bool `long:"only-push" description:"Only commit and push local changes, don't pull"`
+	DryRun   bool `short:"n" long:"dry-run" description:"Fetch and report what would be done, without committing, pulling or pushing"`
+	Args     struct {
+		Ks []string `positional-arg-name:"K" description:"IDs of the Ks to sync (default: all)"`
+	} `positional-args:"yes"`
+}
+
+// kSync is the outcome of syncing a single K.
+type kSync struct {
+	id     string
+	k      cfg.K
+	status string
+	detail string
+	output bytes.Buffer // git output, kept per K so concurrent syncs don't interleave
+	err    error
+}
 
 // Execute runs the sync command.
 func (c *SyncCommand) Execute(_ []string) error {
-	errs := []string{}
-	msgs := []string{}
-	for kID, k := range cfg.GlobalCfg.Ks {
-
-		// skip manually synced Ks
-		if k.URL == "" {
-			log.Info().Msgf("skipping K '%s' (manual sync)", kID)
-			continue
+	if c.OnlyPull && c.OnlyPush {
+		return fmt.Errorf("--only-pull and --only-push are mutually exclusive")
+	}
+
+	ids := make([]string, 0, len(c.config.Ks))
+	for kID := range c.config.Ks {
+		ids = append(ids, kID)
+	}
+	sort.Strings(ids)
+	if len(c.Args.Ks) > 0 {
+		for _, kID := range c.Args.Ks {
+			if _, ok := c.config.Ks[kID]; !ok {
+				return fmt.Errorf("no such K '%s'\nAvailable Ks: %s", kID, strings.Join(ids, ", "))
+			}
 		}
-		log.Info().Msgf("syncing K '%s' (auto sync)", kID)
-
-		if hadToInitialize := ensureInitialized(kID, k); !hadToInitialize {
-
-			fmt.Println("updating", kID)
-			cmd := exec.Command(
-				"bash", "-c",
-				fmt.Sprintf(`
-				cd "%s"
-				local_update=false
-				remote_update=false
-				if [[ $(git status --porcelain) ]]; then
-				  local_update=true
-				fi
-				git fetch
-				local_head=$(git rev-parse @)
-				remote_head=$(git rev-parse @{u})
-				if [[ "${local_head}" != "${remote_head}" ]]; then
-				  remote_update=true
-				fi
-				
-				if [ "${local_update}" == "true" ]; then
-				  git add .
-				  git commit -m "%s Update"
-				fi
-				can_push=true
-				if [ "${remote_update}" == "true" ]; then
-				  git pull --rebase || can_push=false
-				fi
-				if [ "${local_update}" == "true" ]; then
-				  if [ "${can_push}" == "true" ]; then
-				    git push
-				  else
-				    echo "WARN: cannot push update in %s yet!"
-						exit 1
-				  fi
-				fi`,
-					k.Path, strings.Split(time.Now().Local().Format(time.RFC3339), "T")[0], kID,
-				),
-			)
-			cmd.Stdout, cmd.Stderr, cmd.Stdin = os.Stdout, os.Stderr, os.Stdin
-
-			if err := cmd.Run(); err != nil {
-				errs = append(errs, err.Error())
-				msgs = append(
-					msgs,
-					fmt.Sprintf(
-						"%s could not be synced!\nDo `cd '%s'` and resolve it there.\n",
-						kID,
-						k.Path,
-					),
-				)
+		ids = slices.Compact(slices.Sorted(slices.Values(c.Args.Ks)))
+	}
+
+	jobs := c.Jobs
+	if jobs <= 0 {
+		jobs = c.config.Settings.SyncJobs
+	}
+	if jobs <= 0 {
+		jobs = defaultSyncJobs
+	}
+
+	results := make([]*kSync, len(ids))
+	todo := make(chan int)
+	wg := sync.WaitGroup{}
+	for range min(jobs, len(ids)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range todo {
+				results[i] = c.syncK(ids[i], c.config.Ks[ids[i]])
 			}
-		} else {
-			log.Info().Str("K", kID).Msg("as K was just cloned, skipped pull/push for it")
+		}()
+	}
+	log.Info().Int("Ks", len(ids)).Int("jobs", jobs).Bool("dry-run", c.DryRun).Msg("syncing Ks")
+	for i := range ids {
+		todo <- i
+	}
+	close(todo)
+	wg.Wait()
+
+	failed := []string{}
+	for _, r := range results {
+		if r.output.Len() > 0 {
+			fmt.Printf("==> %s\n%s\n\n", r.id, strings.TrimRight(r.output.String(), "\n"))
 		}
+		if r.err != nil {
+			failed = append(failed, r.id)
+		}
+	}
+
+	table := bytes.Buffer{}
+	tw := tabwriter.NewWriter(&table, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "K\tSTATUS\tDETAIL")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.id, r.status, r.detail)
 	}
-	if len(errs) != 0 {
-		for _, msg := range msgs {
-			fmt.Println(msg)
+	if err := tw.Flush(); err != nil {
+		return fmt.Errorf("unable to format summary (%s)", err.Error())
+	}
+	fmt.Print(table.String())
+
+	if len(failed) != 0 {
+		fmt.Println()
+		for _, r := range results {
+			if r.err != nil {
+				fmt.Println(describeSyncError(r.id, r.k, r.err))
+			}
 		}
-		return fmt.Errorf("some errors occurred %#v", errs)
+		return fmt.Errorf("could not sync %d K(s): %s", len(failed), strings.Join(failed, ", "))
 	}
 
 	return nil
 }
 
-func ensureInitialized(kID string, k cfg.K) (initialized bool) {
-	_, err := os.Stat(k.Path)
+// syncK syncs a single K, buffering all of its output in the result.
+func (c *SyncCommand) syncK(kID string, k cfg.K) *kSync {
+	r := &kSync{id: kID, k: k}
+
+	// skip manually synced Ks
+	if k.URL == "" {
+		r.status, r.detail = "skipped", "manual sync (no url)"
+		return r
+	}
+
+	opts, err := c.options(kID, k)
+	if err != nil {
+		r.status, r.err = "failed", err
+		return r
+	}
+
+	if c.DryRun {
+		if _, err := os.Stat(k.Path); errors.Is(err, fs.ErrNotExist) {
+			r.status, r.detail = "would clone", k.URL
+			return r
+		}
+	}
+	hadToInitialize, err := ensureInitialized(k, &r.output)
+	if err != nil {
+		r.status, r.err = "failed", err
+		return r
+	}
+	if hadToInitialize {
+		r.status, r.detail = "cloned", "just cloned, skipped pull/push"
+		return r
+	}
+
+	repo := &gitsync.Repo{Dir: k.Path, Remote: k.Sync.Remote, Branch: k.Sync.Branch, Output: &r.output, Ignore: c.ignoreFunc(k)}
+	res, err := repo.Sync(opts)
+	r.err = err
+	r.status = syncStatus(res, err)
+	if c.DryRun && err == nil {
+		r.status = dryRunStatus(res)
+	}
+	r.detail = syncDetail(res)
+	return r
+}
+
+// options builds the sync options for a K from its sync policy and the
+// command line.
+func (c *SyncCommand) options(kID string, k cfg.K) (gitsync.Options, error) {
+	conflicts, err := gitsync.ParseConflictStrategy(k.Sync.Conflicts)
+	if err != nil {
+		return gitsync.Options{}, err
+	}
+	merge := false
+	switch k.Sync.Strategy {
+	case "", "rebase":
+	case "merge":
+		merge = true
+	default:
+		return gitsync.Options{}, fmt.Errorf("unknown sync strategy '%s' (expected 'rebase' or 'merge')", k.Sync.Strategy)
+	}
+	autoCommit := k.Sync.AutoCommit == nil || *k.Sync.AutoCommit
+
+	return gitsync.Options{
+		Message:   c.commitMessage(kID, k),
+		Conflicts: conflicts,
+		Merge:     merge,
+		NoCommit:  !autoCommit || c.OnlyPull,
+		NoPull:    c.OnlyPush,
+		NoPush:    c.OnlyPull,
+		DryRun:    c.DryRun,
+	}, nil
+}
+
+// commitMessage returns a builder for commit messages describing the changes
+// staged in a K, filled into the configured template.
+func (c *configured) commitMessage(kID string, k cfg.K) func([]gitsync.Change) (string, error) {
+	return func(staged []gitsync.Change) (string, error) {
+		host, _ := os.Hostname()
+		return gitsync.CommitInfo{
+			Summary: gitsync.Summarize(k.Path, staged),
+			K:       kID,
+			Host:    host,
+			Today:   strings.Split(time.Now().Local().Format(time.RFC3339), "T")[0],
+			Now:     time.Now().Local().Format(time.RFC3339),
+		}.Render(c.config.Settings.CommitMessage)
+	}
+}
+
+// syncStatus condenses a sync result into a single word for the summary.
+func syncStatus(res *gitsync.Result, err error) string {
+	var conflictErr *gitsync.ConflictError
+	var rejectedErr *gitsync.PushRejectedError
+	switch {
+	case errors.As(err, &conflictErr):
+		return "conflict"
+	case errors.As(err, &rejectedErr):
+		return "rejected"
+	case err != nil:
+		return "failed"
+	case len(res.KeptBoth) > 0:
+		return "merged"
+	case res.Pulled && res.Pushed:
+		return "pulled+pushed"
+	case res.Pulled:
+		return "pulled"
+	case res.Pushed:
+		return "pushed"
+	default:
+		return "up-to-date"
+	}
+}
+
+// dryRunStatus condenses what a dry run would do into a single word.
+func dryRunStatus(res *gitsync.Result) string {
+	steps := []string{}
+	if res.Committed {
+		steps = append(steps, "commit")
+	}
+	if res.Pulled {
+		steps = append(steps, "pull")
+	}
+	if res.Pushed {
+		steps = append(steps, "push")
+	}
+	if len(steps) == 0 {
+		return "up-to-date"
+	}
+	return "would " + strings.Join(steps, "+")
+}
+
+// syncDetail describes the state a K was found in before syncing.
+func syncDetail(res *gitsync.Result) string {
+	details := []string{}
+	if n := len(res.Before.Dirty); n > 0 {
+		details = append(details, fmt.Sprintf("%d changed", n))
+	}
+	if res.Before.Ahead > 0 {
+		details = append(details, fmt.Sprintf("%d ahead", res.Before.Ahead))
+	}
+	if res.Before.Behind > 0 {
+		details = append(details, fmt.Sprintf("%d behind", res.Before.Behind))
+	}
+	if n := len(res.KeptBoth); n > 0 {
+		details = append(details, fmt.Sprintf("kept both versions of %d conflicting file(s)", n))
+	}
+	return strings.Join(details, ", ")
+}
+
+// describeSyncError explains a failed sync of a K, depending on which step
+// failed.
+func describeSyncError(kID string, k cfg.K, err error) string {
+	var conflictErr *gitsync.ConflictError
+	var rejectedErr *gitsync.PushRejectedError
+	switch {
+	case errors.As(err, &conflictErr):
+		return fmt.Sprintf(
+			"%s has conflicts in:\n  %s\nDo `cd '%s'` and resolve them there (or `git rebase --abort`).\n",
+			kID, strings.Join(conflictErr.Files, "\n  "), k.Path,
+		)
+	case errors.As(err, &rejectedErr):
+		return fmt.Sprintf(
+			"%s could not be pushed, the remote rejected it (it likely changed meanwhile).\nRun sync again or do `cd '%s'` and push there.\n",
+			kID, k.Path,
+		)
+	case errors.Is(err, gitsync.ErrNoUpstream):
+		return fmt.Sprintf(
+			"%s has no upstream branch to sync with.\nDo `cd '%s'` and set one (`git push -u`).\n",
+			kID, k.Path,
+		)
+	default:
+		return fmt.Sprintf(
+			"%s could not be synced (%s)!\nDo `cd '%s'` and resolve it there.\n",
+			kID, err.Error(), k.Path,
+		)
+	}
+}
+
+// ignoreFunc returns the function telling gitsync which changed paths of a K
+// to leave alone.
+func (c *configured) ignoreFunc(k cfg.K) func(string) bool {
+	m := c.config.Ignore(k)
+	return func(file string) bool { return m.Ignored(file, false) }
+}
+
+// ensureInitialized clones the K if its path does not exist yet, writing
+// git's output to out.
+func ensureInitialized(k cfg.K, out io.Writer) (initialized bool, err error) {
+	_, err = os.Stat(k.Path)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			log.Info().Str("K", kID).Str("path", k.Path).Msg("K's path does not exist, initializing it by git clone")
-			clone := exec.Command("git", "clone", k.URL, k.Path)
-			clone.Stdout, clone.Stderr, clone.Stdin = os.Stdout, os.Stderr, os.Stdin
-			err := clone.Run()
-			if err != nil {
-				log.Error().
-					Err(err).
-					Strs("args", clone.Args).
-					Str("K", kID).
-					Msg("error executing clone command")
+			fmt.Fprintf(out, "path '%s' does not exist, initializing it by git clone\n", k.Path)
+			if err := gitsync.Clone(k.URL, k.Path, out); err != nil {
+				return true, fmt.Errorf("unable to clone (%w)", err)
 			}
-			return true
-		} else {
-			log.Fatal().Str("path", k.Path).Msg("stat err for K path but it appears to exist?")
+			return true, nil
 		}
+		return false, fmt.Errorf("unable to stat K path '%s' (%w)", k.Path, err)
 	}
-	return false
+	return false, nil
 }
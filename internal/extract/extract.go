@@ -0,0 +1,118 @@
+// Package extract extracts searchable text from documents that are not
+// plain text, such as PDFs.
+//
+// Extractors are registered per file extension. Extracted text is cached
+// by the hash of the file's contents, so unchanged documents are only ever
+// extracted once.
+package extract
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Page is the text of a single page of a document. Documents without a
+// notion of pages have a single page numbered 0.
+type Page struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+	// Line is the line of the file the text's first line is on, for
+	// documents that are themselves text and whose lines are kept, like
+	// HTML; 0 otherwise.
+	Line int `json:"line,omitempty"`
+}
+
+// Extractor extracts the text of a file.
+type Extractor interface {
+	Extract(file string) ([]Page, error)
+}
+
+// ExtractorFunc adapts a function to an Extractor.
+type ExtractorFunc func(file string) ([]Page, error)
+
+// Extract calls f.
+func (f ExtractorFunc) Extract(file string) ([]Page, error) { return f(file) }
+
+var (
+	mu         sync.RWMutex
+	extractors = map[string]Extractor{
+		"pdf":  ExtractorFunc(extractPDF),
+		"html": ExtractorFunc(extractHTML),
+		"htm":  ExtractorFunc(extractHTML),
+		"xopp": ExtractorFunc(extractXopp),
+		"docx": ExtractorFunc(extractDocx),
+	}
+)
+
+// Register sets the extractor for files with the extension ext (without
+// the leading dot), replacing any previous one.
+func Register(ext string, e Extractor) {
+	mu.Lock()
+	defer mu.Unlock()
+	extractors[strings.ToLower(ext)] = e
+}
+
+// For returns the extractor for a file, based on its extension.
+func For(file string) (Extractor, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	e, ok := extractors[strings.ToLower(strings.TrimPrefix(path.Ext(file), "."))]
+	return e, ok
+}
+
+// Text extracts the text of a file with the extractor registered for it,
+// using the cached text if the file's contents were extracted before.
+func Text(file string) ([]Page, error) {
+	e, ok := For(file)
+	if !ok {
+		return nil, fmt.Errorf("no extractor for '%s'", path.Ext(file))
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	cacheFile, cacheErr := cacheFile(hex.EncodeToString(sum[:]))
+	if cacheErr == nil {
+		if cached, err := os.ReadFile(cacheFile); err == nil {
+			pages := []Page{}
+			if err := json.Unmarshal(cached, &pages); err == nil {
+				return pages, nil
+			}
+		}
+	}
+
+	pages, err := e.Extract(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to extract text from '%s' (%w)", file, err)
+	}
+	if cacheErr == nil {
+		// failing to cache only costs time on the next extraction
+		if data, err := json.Marshal(pages); err == nil {
+			if err := os.MkdirAll(path.Dir(cacheFile), 0755); err == nil {
+				_ = os.WriteFile(cacheFile, data, 0644)
+			}
+		}
+	}
+	return pages, nil
+}
+
+// cacheVersion is bumped whenever the extracted text changes, which makes
+// existing cache entries be ignored.
+const cacheVersion = 2
+
+// cacheFile is where the text extracted from contents with the given hash
+// is cached.
+func cacheFile(hash string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, "z", "extract", fmt.Sprintf("%s.v%d.json", hash, cacheVersion)), nil
+}
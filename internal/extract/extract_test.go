@@ -0,0 +1,60 @@
+package extract
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFor(t *testing.T) {
+	for file, want := range map[string]bool{"a.pdf": true, "a.PDF": true, "dir/a.html": true, "a.md": false, "pdf": false} {
+		if _, ok := For(file); ok != want {
+			t.Errorf("For(%q) found an extractor: %v, want %v", file, ok, want)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("HOME", dir)
+
+	calls := 0
+	Register("Test-Ext", ExtractorFunc(func(file string) ([]Page, error) {
+		calls++
+		data, err := os.ReadFile(file)
+		return []Page{{Number: 1, Text: string(data)}}, err
+	}))
+	a, b := filepath.Join(dir, "a.test-ext"), filepath.Join(dir, "b.test-ext")
+	for _, file := range []string{a, b} {
+		if err := os.WriteFile(file, []byte("same"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []Page{{Number: 1, Text: "same"}}
+	for _, file := range []string{a, a, b} {
+		pages, err := Text(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(pages, want) {
+			t.Errorf("Text(%q) = %v, want %v", file, pages, want)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("the same contents were extracted %d times, want once", calls)
+	}
+
+	if err := os.WriteFile(a, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if pages, err := Text(a); err != nil || len(pages) != 1 || pages[0].Text != "changed" || calls != 2 {
+		t.Errorf("Text() of changed contents = %v (%v) after %d extractions", pages, err, calls)
+	}
+
+	if _, err := Text(filepath.Join(dir, "a.unknown")); err == nil {
+		t.Errorf("Text() of a file without extractor succeeded")
+	}
+}
@@ -0,0 +1,159 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// extractPDF uses pdftotext, which separates pages by form feeds.
+func extractPDF(file string) ([]Page, error) {
+	out, err := exec.Command("pdftotext", "-layout", file, "-").Output()
+	if err != nil {
+		return nil, fmt.Errorf("pdftotext failed (%w)", err)
+	}
+	pages := []Page{}
+	for i, text := range strings.Split(strings.TrimSuffix(string(out), "\f"), "\f") {
+		pages = append(pages, Page{Number: i + 1, Text: text})
+	}
+	return pages, nil
+}
+
+var (
+	htmlInvisible = regexp.MustCompile(`(?is)<(script|style|head)\b.*?</(script|style|head)\s*>|<!--.*?-->`)
+	htmlBlock     = regexp.MustCompile(`(?i)</?(p|div|br|li|tr|h[1-6]|pre|blockquote|section|article|table|ul|ol)\b[^>]*>`)
+	htmlTag       = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// extractHTML strips the markup. The text is kept on the lines it is on in
+// the file, so that search hits can point at them.
+func extractHTML(file string) ([]Page, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	// what is removed is replaced by the line breaks in it
+	keepLines := func(replacement string) func(string) string {
+		return func(m string) string { return replacement + strings.Repeat("\n", strings.Count(m, "\n")) }
+	}
+	text := htmlInvisible.ReplaceAllStringFunc(string(data), keepLines(""))
+	text = htmlBlock.ReplaceAllStringFunc(text, keepLines(" "))
+	text = htmlTag.ReplaceAllStringFunc(text, keepLines(""))
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		// an escaped line break must not add a line
+		lines[i] = strings.ReplaceAll(html.UnescapeString(line), "\n", " ")
+	}
+	return []Page{{Number: 0, Line: 1, Text: strings.Join(lines, "\n")}}, nil
+}
+
+// extractXopp reads the text elements of a (gzipped) Xournal++ document.
+func extractXopp(file string) ([]Page, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := []Page{}
+	inText := false
+	d := xml.NewDecoder(gz)
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "page":
+				pages = append(pages, Page{Number: len(pages) + 1})
+			case "text":
+				inText = true
+			}
+		case xml.EndElement:
+			if t.Name.Local == "text" {
+				inText = false
+				if len(pages) > 0 {
+					pages[len(pages)-1].Text += "\n"
+				}
+			}
+		case xml.CharData:
+			if inText && len(pages) > 0 {
+				pages[len(pages)-1].Text += string(t)
+			}
+		}
+	}
+	return pages, nil
+}
+
+// extractDocx reads the paragraphs of a Word document.
+func extractDocx(file string) ([]Page, error) {
+	r, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	for _, f := range r.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = rc.Close() }()
+
+		text := bytes.Buffer{}
+		inText := false
+		d := xml.NewDecoder(rc)
+		for {
+			token, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			switch t := token.(type) {
+			case xml.StartElement:
+				switch t.Name.Local {
+				case "t":
+					inText = true
+				case "tab":
+					text.WriteByte('\t')
+				case "br":
+					text.WriteByte('\n')
+				}
+			case xml.EndElement:
+				switch t.Name.Local {
+				case "t":
+					inText = false
+				case "p":
+					text.WriteByte('\n')
+				}
+			case xml.CharData:
+				if inText {
+					text.Write(t)
+				}
+			}
+		}
+		return []Page{{Number: 0, Text: strings.TrimSpace(text.String())}}, nil
+	}
+	return nil, fmt.Errorf("no word/document.xml in archive")
+}
@@ -0,0 +1,95 @@
+package extract
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExtractHTML(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "page.html")
+	html := "<html>\n<head>\n<title>skipped</title>\n</head>\n<body>\n" +
+		"<h1>Title</h1>\n" +
+		"<script>\nskipped()\n</script>\n" +
+		"<p>one <b>bold</b><br>two</p>\n" +
+		"<!-- a\ncomment -->Fish &amp; chips &#10;today\n" +
+		"</body>\n</html>\n"
+	if err := os.WriteFile(file, []byte(html), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pages, err := extractHTML(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Page{{Number: 0, Line: 1, Text: "\n\n\n\n\n Title \n\n\n\n one bold two \n\nFish & chips  today\n\n\n"}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("extractHTML() = %#v, want %#v", pages, want)
+	}
+}
+
+func TestExtractXopp(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "note.xopp")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	_, err = gz.Write([]byte(`<?xml version="1.0"?>
+<xournal><page><layer><text>first</text><stroke>1 2</stroke><text>second</text></layer></page>
+<page><layer/></page><page><layer><text>third</text></layer></page></xournal>`))
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := extractXopp(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Page{{Number: 1, Text: "first\nsecond\n"}, {Number: 2}, {Number: 3, Text: "third\n"}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("extractXopp() = %#v, want %#v", pages, want)
+	}
+}
+
+func TestExtractDocx(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "doc.docx")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := zip.NewWriter(f)
+	w, err := z.Create("word/document.xml")
+	if err == nil {
+		_, err = w.Write([]byte(`<w:document xmlns:w="w"><w:body>
+<w:p><w:r><w:t>one</w:t><w:tab/><w:t>two</w:t></w:r></w:p>
+<w:p><w:r><w:t>three</w:t><w:br/><w:t>four</w:t></w:r></w:p>
+</w:body></w:document>`))
+	}
+	if err == nil {
+		err = z.Close()
+	}
+	if err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := extractDocx(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Page{{Number: 0, Text: "one\ttwo\nthree\nfour"}}
+	if !reflect.DeepEqual(pages, want) {
+		t.Errorf("extractDocx() = %#v, want %#v", pages, want)
+	}
+}
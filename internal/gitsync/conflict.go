@@ -0,0 +1,178 @@
+package gitsync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ConflictStrategy decides what a Sync does when pulling hits conflicts.
+type ConflictStrategy string
+
+const (
+	// StopOnConflict leaves the rebase in progress for manual resolution.
+	StopOnConflict ConflictStrategy = "stop"
+	// KeepBoth aborts the rebase and merges instead, keeping both versions of
+	// every conflicting file side by side, so the K is never left mid-rebase.
+	KeepBoth ConflictStrategy = "keep-both"
+)
+
+// ParseConflictStrategy parses a strategy as configured; empty means
+// StopOnConflict.
+func ParseConflictStrategy(s string) (ConflictStrategy, error) {
+	switch ConflictStrategy(s) {
+	case "", StopOnConflict:
+		return StopOnConflict, nil
+	case KeepBoth:
+		return KeepBoth, nil
+	default:
+		return "", fmt.Errorf("unknown conflict strategy '%s' (expected '%s' or '%s')", s, StopOnConflict, KeepBoth)
+	}
+}
+
+// ConflictName returns the name the local version of a conflicting file is
+// kept under, e.g. 'notes/a.md' becomes 'notes/a.conflict-<host>-<date>.md'.
+func ConflictName(file, host, date string) string {
+	dir, base := filepath.Split(file)
+	ext := filepath.Ext(base)
+	if ext == base {
+		// dotfiles like '.gitignore' have no extension to speak of
+		ext = ""
+	}
+	stem := strings.TrimSuffix(base, ext)
+	return dir + fmt.Sprintf("%s.conflict-%s-%s%s", stem, host, date, ext)
+}
+
+// mergeKeepingBoth aborts the rebase that stopped on conflicts and merges
+// the upstream instead, resolving conflicts with resolveKeepingBoth.
+func (r *Repo) mergeKeepingBoth(upstream, host, date string) ([]string, error) {
+	if err := r.run("rebase", "--abort"); err != nil {
+		return nil, fmt.Errorf("unable to abort rebase (%w)", err)
+	}
+	if err := r.run("merge", "--no-edit", upstream); err == nil {
+		return nil, nil
+	}
+	return r.resolveKeepingBoth(host, date)
+}
+
+// resolveKeepingBoth resolves each conflicting file of the merge in progress
+// by keeping the upstream version under its name and the local one under
+// ConflictName, and commits the merge. It returns the files that were
+// resolved this way. If anything fails, the merge is aborted.
+func (r *Repo) resolveKeepingBoth(host, date string) ([]string, error) {
+	conflicts, err := r.Unmerged()
+	if err != nil || len(conflicts) == 0 {
+		_ = r.run("merge", "--abort")
+		return nil, fmt.Errorf("unable to merge, and no conflicts to resolve")
+	}
+	for _, file := range conflicts {
+		if err := r.keepBoth(file, host, date); err != nil {
+			_ = r.run("merge", "--abort")
+			return nil, fmt.Errorf("unable to keep both versions of '%s' (%w)", file, err)
+		}
+	}
+	if err := r.run("commit", "--no-edit", "--quiet"); err != nil {
+		_ = r.run("merge", "--abort")
+		return nil, fmt.Errorf("unable to commit merge (%w)", err)
+	}
+	return conflicts, nil
+}
+
+// keepBoth resolves a single conflicting file during a merge.
+func (r *Repo) keepBoth(file, host, date string) error {
+	stages, err := r.output("ls-files", "--unmerged", "-z", "--", file)
+	if err != nil {
+		return err
+	}
+	hasOurs, hasTheirs := false, false
+	// both versions keep the mode of the file, or of the index if it is gone, so
+	// that an executable stays executable
+	mode := os.FileMode(0644)
+	for _, entry := range strings.Split(stages, "\x00") {
+		// '<mode> <object> <stage>\t<file>'
+		fields := strings.Fields(strings.SplitN(entry, "\t", 2)[0])
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "100755" {
+			mode = 0755
+		}
+		switch fields[2] {
+		case "2":
+			hasOurs = true
+		case "3":
+			hasTheirs = true
+		}
+	}
+
+	full := filepath.Join(r.Dir, file)
+	if info, err := os.Stat(full); err == nil {
+		mode = info.Mode().Perm()
+	}
+	switch {
+	case hasOurs && hasTheirs:
+		ours, err := r.output("cat-file", "blob", ":2:"+file)
+		if err != nil {
+			return err
+		}
+		theirs, err := r.output("cat-file", "blob", ":3:"+file)
+		if err != nil {
+			return err
+		}
+		conflictFile := ConflictName(file, host, date)
+		for i := 2; ; i++ {
+			_, err := os.Stat(filepath.Join(r.Dir, conflictFile))
+			if errors.Is(err, os.ErrNotExist) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("could not check for conflict file '%s' (%w)", conflictFile, err)
+			}
+			conflictFile = ConflictName(file, host, fmt.Sprintf("%s-%d", date, i))
+		}
+		if err := os.WriteFile(full, []byte(theirs), mode); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(r.Dir, conflictFile), []byte(ours), mode); err != nil {
+			return err
+		}
+		return r.run("add", "--", file, conflictFile)
+
+	case hasOurs:
+		// deleted upstream but changed locally: keep the local version
+		ours, err := r.output("cat-file", "blob", ":2:"+file)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(full, []byte(ours), mode); err != nil {
+			return err
+		}
+		return r.run("add", "--", file)
+
+	case hasTheirs:
+		// deleted locally but changed upstream: keep the upstream version
+		theirs, err := r.output("cat-file", "blob", ":3:"+file)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(full, []byte(theirs), mode); err != nil {
+			return err
+		}
+		return r.run("add", "--", file)
+
+	default:
+		return fmt.Errorf("no versions of file found in index")
+	}
+}
+
+// hostname returns the short host name used in conflict file names.
+func hostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+	host, _, _ = strings.Cut(host, ".")
+	return host
+}
@@ -0,0 +1,102 @@
+package gitsync
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestConflictName(t *testing.T) {
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"a.md", "a.conflict-host-date.md"},
+		{"notes/a.md", "notes/a.conflict-host-date.md"},
+		{"notes/archive.tar.gz", "notes/archive.tar.conflict-host-date.gz"},
+		{"Makefile", "Makefile.conflict-host-date"},
+		{".gitignore", ".gitignore.conflict-host-date"},
+	}
+	for _, tt := range tests {
+		if got := ConflictName(tt.file, "host", "date"); got != tt.want {
+			t.Errorf("ConflictName(%q) = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestKeepBoth(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(rel, content string, mode os.FileMode) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, rel), []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "--quiet", "--initial-branch=main")
+	git("config", "user.name", "test")
+	git("config", "user.email", "test@example.com")
+	write("note.md", "base\n", 0644)
+	write("run.sh", "#!/bin/sh\necho base\n", 0755)
+	git("add", "--all")
+	git("commit", "--quiet", "-m", "base")
+	git("checkout", "--quiet", "-b", "theirs")
+	write("note.md", "theirs\n", 0644)
+	write("run.sh", "#!/bin/sh\necho theirs\n", 0755)
+	git("commit", "--quiet", "-am", "theirs")
+	git("checkout", "--quiet", "main")
+	write("note.md", "ours\n", 0644)
+	write("run.sh", "#!/bin/sh\necho ours\n", 0755)
+	git("commit", "--quiet", "-am", "ours")
+
+	r := &Repo{Dir: dir}
+	if err := r.run("merge", "--no-edit", "theirs"); err == nil {
+		t.Fatal("merge should conflict")
+	}
+	for _, file := range []string{"note.md", "run.sh"} {
+		if err := r.keepBoth(file, "host", "date"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.run("commit", "--no-edit", "--quiet"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		file    string
+		content string
+		mode    os.FileMode
+	}{
+		{"note.md", "theirs\n", 0644},
+		{"note.conflict-host-date.md", "ours\n", 0644},
+		{"run.sh", "#!/bin/sh\necho theirs\n", 0755},
+		{"run.conflict-host-date.sh", "#!/bin/sh\necho ours\n", 0755},
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, tt.file))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(data) != tt.content {
+			t.Errorf("%s contains %q, want %q", tt.file, data, tt.content)
+		}
+		if info, err := os.Stat(filepath.Join(dir, tt.file)); err == nil && info.Mode().Perm() != tt.mode {
+			t.Errorf("%s has mode %v, want %v", tt.file, info.Mode().Perm(), tt.mode)
+		}
+	}
+	if status, err := r.Status(); err != nil || len(status.Dirty) != 0 {
+		t.Errorf("the merge left changes behind: %v (%v)", status, err)
+	}
+}
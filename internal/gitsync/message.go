@@ -0,0 +1,240 @@
+package gitsync
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"z/internal/cfg"
+)
+
+// DefaultCommitMessage is the commit message template used unless one is
+// configured.
+const DefaultCommitMessage = `{{.Today}} {{.Subject}}
+{{- with .Body}}
+
+{{.}}{{end}}`
+
+// Rename is a renamed Z-note or file.
+type Rename struct {
+	From string
+	To   string
+}
+
+func (r Rename) String() string { return r.From + " -> " + r.To }
+
+// Summary describes changes in terms of Z-notes: changes to files inside a
+// Z-note are attributed to the note (its directory, relative to the K), all
+// other files are listed by their path.
+type Summary struct {
+	Created  []string
+	Modified []string
+	Deleted  []string
+	Renamed  []Rename
+}
+
+// CommitInfo is the data passed to the commit message template.
+type CommitInfo struct {
+	Summary
+	K     string
+	Host  string
+	Today string
+	Now   string
+}
+
+// noteOfZFile returns the note a path belongs to if it is the note's
+// .z/z.yml.
+func noteOfZFile(p string) (string, bool) {
+	zFile := "/" + path.Join(".z", "z.yml")
+	if strings.HasSuffix(p, zFile) {
+		return strings.TrimSuffix(p, zFile), true
+	}
+	return "", false
+}
+
+// noteFinder returns a function finding the Z-note a changed path in the K
+// at root belongs to. Notes are recognized on disk as well as by changes to
+// their .z/z.yml, so deleted notes are found too.
+func noteFinder(root string, changes []Change) func(string) (string, bool) {
+	known := map[string]bool{}
+	for _, c := range changes {
+		for _, p := range []string{c.Path, c.From} {
+			if note, ok := noteOfZFile(p); ok {
+				known[note] = true
+			}
+		}
+	}
+	return func(p string) (string, bool) {
+		for d := path.Dir(p); d != "." && d != "/"; d = path.Dir(d) {
+			if known[d] || cfg.IsNote(path.Join(root, d)) {
+				return d, true
+			}
+		}
+		return "", false
+	}
+}
+
+// NoteChanges are the changes belonging to a single Z-note, or to no note
+// at all if Note is empty.
+type NoteChanges struct {
+	Note    string   `json:"note"`
+	Changes []Change `json:"changes"`
+}
+
+// GroupByNote groups the changes in the K at root by the Z-note they belong
+// to, sorted by note, with the changes outside of any note last.
+func GroupByNote(root string, changes []Change) []NoteChanges {
+	noteOf := noteFinder(root, changes)
+	byNote := map[string][]Change{}
+	for _, c := range changes {
+		note, _ := noteOf(c.Path)
+		byNote[note] = append(byNote[note], c)
+	}
+	groups := []NoteChanges{}
+	for note, cs := range byNote {
+		groups = append(groups, NoteChanges{Note: note, Changes: cs})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if (groups[i].Note == "") != (groups[j].Note == "") {
+			return groups[j].Note == ""
+		}
+		return groups[i].Note < groups[j].Note
+	})
+	return groups
+}
+
+// Summarize groups the changes in the K at root by Z-note.
+func Summarize(root string, changes []Change) Summary {
+	noteOf := noteFinder(root, changes)
+
+	s := Summary{}
+	seen := map[string]bool{}
+	add := func(list *[]string, name string) {
+		if !seen[name] {
+			seen[name] = true
+			*list = append(*list, name)
+		}
+	}
+
+	// notes being created, deleted or renamed as a whole
+	for _, c := range changes {
+		note, ok := noteOfZFile(c.Path)
+		if !ok {
+			continue
+		}
+		switch c.Code[0] {
+		case 'A', 'C', '?':
+			add(&s.Created, note)
+		case 'D':
+			add(&s.Deleted, note)
+		case 'R':
+			if from, ok := noteOfZFile(c.From); ok && from != note {
+				seen[from], seen[note] = true, true
+				s.Renamed = append(s.Renamed, Rename{From: from, To: note})
+			}
+		}
+	}
+
+	for _, c := range changes {
+		if c.From != "" {
+			if note, ok := noteOf(c.From); ok {
+				add(&s.Modified, note)
+			}
+		}
+		if note, ok := noteOf(c.Path); ok {
+			add(&s.Modified, note)
+			continue
+		}
+		switch c.Code[0] {
+		case 'A', 'C', '?':
+			add(&s.Created, c.Path)
+		case 'D':
+			add(&s.Deleted, c.Path)
+		case 'R':
+			if _, fromNote := noteOf(c.From); !fromNote {
+				s.Renamed = append(s.Renamed, Rename{From: c.From, To: c.Path})
+			} else {
+				add(&s.Created, c.Path)
+			}
+		default:
+			add(&s.Modified, c.Path)
+		}
+	}
+	return s
+}
+
+// Subject is a one-line description of the changes.
+func (s Summary) Subject() string {
+	list := func(names []string) string {
+		if len(names) > 3 {
+			return fmt.Sprintf("%s and %d more", strings.Join(names[:3], ", "), len(names)-3)
+		}
+		return strings.Join(names, ", ")
+	}
+	parts := []string{}
+	if len(s.Created) > 0 {
+		parts = append(parts, "created "+list(s.Created))
+	}
+	if len(s.Modified) > 0 {
+		parts = append(parts, "modified "+list(s.Modified))
+	}
+	if len(s.Deleted) > 0 {
+		parts = append(parts, "deleted "+list(s.Deleted))
+	}
+	if len(s.Renamed) > 0 {
+		renames := make([]string, len(s.Renamed))
+		for i, r := range s.Renamed {
+			renames[i] = r.String()
+		}
+		parts = append(parts, "renamed "+list(renames))
+	}
+	if len(parts) == 0 {
+		return "Update"
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Body lists every change on its own line, or is empty if the subject
+// already names all of them.
+func (s Summary) Body() string {
+	if len(s.Created)+len(s.Modified)+len(s.Deleted)+len(s.Renamed) <= 1 {
+		return ""
+	}
+	lines := []string{}
+	for _, n := range s.Created {
+		lines = append(lines, "created:  "+n)
+	}
+	for _, n := range s.Modified {
+		lines = append(lines, "modified: "+n)
+	}
+	for _, n := range s.Deleted {
+		lines = append(lines, "deleted:  "+n)
+	}
+	for _, r := range s.Renamed {
+		lines = append(lines, "renamed:  "+r.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Render fills the commit message template t (DefaultCommitMessage if empty).
+func (i CommitInfo) Render(t string) (string, error) {
+	if t == "" {
+		t = DefaultCommitMessage
+	}
+	tmpl, err := template.New("commit-message").Funcs(cfg.CommitMessageFuncs).Parse(t)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse commit message template (%s)", err.Error())
+	}
+	b := bytes.Buffer{}
+	if err := tmpl.Execute(&b, i); err != nil {
+		return "", fmt.Errorf("could not execute commit message template (%s)", err.Error())
+	}
+	msg := strings.TrimSpace(b.String())
+	if msg == "" {
+		return "", fmt.Errorf("commit message template produced an empty message")
+	}
+	return msg, nil
+}
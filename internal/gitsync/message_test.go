@@ -0,0 +1,98 @@
+package gitsync
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	root := t.TempDir()
+	for _, note := range []string{"existing", "nested/note"} {
+		if err := os.MkdirAll(path.Join(root, note, ".z"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(root, note, ".z", "z.yml"), []byte("{}\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		changes []Change
+		want    Summary
+		subject string
+		body    string
+	}{
+		{
+			name:    "nothing",
+			changes: []Change{},
+			subject: "Update",
+		},
+		{
+			name:    "file in a note",
+			changes: []Change{{Code: "M", Path: "existing/a.md"}, {Code: "A", Path: "existing/b.md"}},
+			want:    Summary{Modified: []string{"existing"}},
+			subject: "modified existing",
+		},
+		{
+			name:    "new note",
+			changes: []Change{{Code: "A", Path: "fresh/.z/z.yml"}, {Code: "A", Path: "fresh/a.md"}},
+			want:    Summary{Created: []string{"fresh"}},
+			subject: "created fresh",
+		},
+		{
+			name:    "deleted note",
+			changes: []Change{{Code: "D", Path: "gone/.z/z.yml"}, {Code: "D", Path: "gone/a.md"}},
+			want:    Summary{Deleted: []string{"gone"}},
+			subject: "deleted gone",
+		},
+		{
+			name:    "renamed note",
+			changes: []Change{{Code: "R", Path: "new/.z/z.yml", From: "old/.z/z.yml"}, {Code: "R", Path: "new/a.md", From: "old/a.md"}},
+			want:    Summary{Renamed: []Rename{{From: "old", To: "new"}}},
+			subject: "renamed old -> new",
+		},
+		{
+			name:    "files outside of notes",
+			changes: []Change{{Code: "??", Path: "a.md"}, {Code: "D", Path: "b.md"}, {Code: "R", Path: "d.md", From: "c.md"}, {Code: " M", Path: "nested/note/x.md"}},
+			want: Summary{
+				Created:  []string{"a.md"},
+				Modified: []string{"nested/note"},
+				Deleted:  []string{"b.md"},
+				Renamed:  []Rename{{From: "c.md", To: "d.md"}},
+			},
+			subject: "created a.md; modified nested/note; deleted b.md; renamed c.md -> d.md",
+			body:    "created:  a.md\nmodified: nested/note\ndeleted:  b.md\nrenamed:  c.md -> d.md",
+		},
+		{
+			name:    "file moved out of a note",
+			changes: []Change{{Code: "R", Path: "loose.md", From: "existing/loose.md"}},
+			want:    Summary{Created: []string{"loose.md"}, Modified: []string{"existing"}},
+			subject: "created loose.md; modified existing",
+			body:    "created:  loose.md\nmodified: existing",
+		},
+		{
+			name:    "many",
+			changes: []Change{{Code: "A", Path: "1.md"}, {Code: "A", Path: "2.md"}, {Code: "A", Path: "3.md"}, {Code: "A", Path: "4.md"}},
+			want:    Summary{Created: []string{"1.md", "2.md", "3.md", "4.md"}},
+			subject: "created 1.md, 2.md, 3.md and 1 more",
+			body:    "created:  1.md\ncreated:  2.md\ncreated:  3.md\ncreated:  4.md",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Summarize(root, tt.changes)
+			if !reflect.DeepEqual(s, tt.want) {
+				t.Errorf("Summarize() = %+v, want %+v", s, tt.want)
+			}
+			if got := s.Subject(); got != tt.subject {
+				t.Errorf("Subject() = %q, want %q", got, tt.subject)
+			}
+			if got := s.Body(); got != tt.body {
+				t.Errorf("Body() = %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
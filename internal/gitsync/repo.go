@@ -0,0 +1,361 @@
+// Package gitsync synchronizes a K's git working tree with its remote.
+//
+// Every step (status, fetch, commit, pull, push) is its own git invocation
+// with a typed result, so callers can tell which step failed and why.
+package gitsync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Repo is a git working tree that can be synced.
+type Repo struct {
+	Dir string
+	// Remote and Branch select the remote branch to sync with; when both are
+	// empty, the current branch's upstream is used. If only one is set, the
+	// other defaults to 'origin' or the current branch, respectively.
+	Remote string
+	Branch string
+	// Output receives the output of the steps that talk to the remote or
+	// change the tree (fetch, commit, pull, push); nil discards it.
+	Output io.Writer
+	// Ignore tells which changed paths are neither reported as dirty nor
+	// staged, on top of what git itself ignores; nil ignores nothing.
+	Ignore func(path string) bool
+}
+
+// Error is returned when a git invocation fails.
+type Error struct {
+	Args   []string
+	Stderr string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("git %s failed (%s)", strings.Join(e.Args, " "), e.Err.Error())
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ConflictError is returned when pulling stopped on conflicting files.
+type ConflictError struct {
+	Files []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicts in %d file(s): %s", len(e.Files), strings.Join(e.Files, ", "))
+}
+
+// PushRejectedError is returned when the remote rejected a push, usually
+// because it received new commits since the last fetch.
+type PushRejectedError struct {
+	Err *Error
+}
+
+func (e *PushRejectedError) Error() string {
+	return fmt.Sprintf("push rejected by remote (%s)", e.Err.Error())
+}
+
+func (e *PushRejectedError) Unwrap() error { return e.Err }
+
+// ErrNoUpstream is returned when the current branch does not track a remote
+// branch, so there is nothing to pull from or push to.
+var ErrNoUpstream = errors.New("current branch has no upstream")
+
+// output runs git, returning its stdout without forwarding anything.
+func (r *Repo) output(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.Dir
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), &Error{Args: args, Stderr: stderr.String(), Err: err}
+	}
+	return stdout.String(), nil
+}
+
+// run runs git, forwarding its output to r.Output.
+func (r *Repo) run(args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.Dir
+	stderr := bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = io.Discard, &stderr
+	if r.Output != nil {
+		// stdout and stderr are copied concurrently, so they must not write
+		// to r.Output unsynchronized
+		out := &lockedWriter{w: r.Output}
+		cmd.Stdout, cmd.Stderr = out, io.MultiWriter(&stderr, out)
+	}
+	if err := cmd.Run(); err != nil {
+		return &Error{Args: args, Stderr: stderr.String(), Err: err}
+	}
+	return nil
+}
+
+// lockedWriter serializes writes to w.
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
+
+// Change is a single uncommitted change as reported by `git status` or,
+// once staged, `git diff --cached`.
+type Change struct {
+	Code string `json:"code"` // porcelain code, e.g. " M" or "??", or a single letter like "A" or "R" if staged
+	Path string `json:"path"`
+	From string `json:"from,omitempty"` // original path of a rename or copy
+}
+
+// Status describes a working tree relative to its upstream.
+type Status struct {
+	Branch   string
+	Upstream string // empty if the branch does not track anything
+	Ahead    int
+	Behind   int
+	Dirty    []Change
+}
+
+// Status reports the working tree's state. It does not fetch, so ahead and
+// behind are relative to the last known state of the upstream.
+func (r *Repo) Status() (*Status, error) {
+	s := &Status{}
+
+	branch, err := r.output("symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine branch (%w)", err)
+	}
+	s.Branch = strings.TrimSpace(branch)
+
+	dirty, err := r.output("status", "--porcelain=v1", "-z", "--untracked-files=all")
+	if err != nil {
+		return nil, fmt.Errorf("unable to get status (%w)", err)
+	}
+	s.Dirty = r.unignored(parsePorcelain(dirty))
+
+	upstream, err := r.upstream(s.Branch)
+	if err != nil {
+		// no upstream configured (or an unborn branch), which is a state, not an error
+		return s, nil
+	}
+	s.Upstream = upstream
+
+	counts, err := r.output("rev-list", "--left-right", "--count", "HEAD..."+upstream)
+	if err != nil {
+		// HEAD may be unborn in a freshly initialized K
+		return s, nil
+	}
+	fields := strings.Fields(counts)
+	if len(fields) != 2 {
+		return nil, fmt.Errorf("unexpected rev-list output '%s'", strings.TrimSpace(counts))
+	}
+	if s.Ahead, err = strconv.Atoi(fields[0]); err != nil {
+		return nil, fmt.Errorf("unexpected ahead count '%s'", fields[0])
+	}
+	if s.Behind, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, fmt.Errorf("unexpected behind count '%s'", fields[1])
+	}
+	return s, nil
+}
+
+// explicit tells whether a remote branch to sync with is configured, rather
+// than the upstream of the current branch.
+func (r *Repo) explicit() bool {
+	return r.Remote != "" || r.Branch != ""
+}
+
+// remoteAndBranch returns the configured remote and branch, filling in
+// defaults for the one not set.
+func (r *Repo) remoteAndBranch(current string) (string, string) {
+	remote, branch := r.Remote, r.Branch
+	if remote == "" {
+		remote = "origin"
+	}
+	if branch == "" {
+		branch = current
+	}
+	return remote, branch
+}
+
+// upstream resolves the remote branch to sync with, e.g. 'origin/main'.
+func (r *Repo) upstream(current string) (string, error) {
+	if r.explicit() {
+		remote, branch := r.remoteAndBranch(current)
+		upstream := remote + "/" + branch
+		if _, err := r.output("rev-parse", "--verify", "--quiet", "refs/remotes/"+upstream); err != nil {
+			return "", err
+		}
+		return upstream, nil
+	}
+	upstream, err := r.output("rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{u}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(upstream), nil
+}
+
+// parsePorcelain parses the output of `git status --porcelain=v1 -z`.
+func parsePorcelain(out string) []Change {
+	changes := []Change{}
+	entries := strings.Split(out, "\x00")
+	for i := 0; i < len(entries); i++ {
+		entry := entries[i]
+		if len(entry) < 4 {
+			continue
+		}
+		c := Change{Code: entry[:2], Path: entry[3:]}
+		if strings.ContainsAny(c.Code, "RC") && i+1 < len(entries) {
+			c.From = entries[i+1]
+			i++
+		}
+		changes = append(changes, c)
+	}
+	return changes
+}
+
+// Fetch fetches from the configured remote, or the default one.
+func (r *Repo) Fetch() error {
+	if r.explicit() {
+		remote, _ := r.remoteAndBranch("")
+		return r.run("fetch", remote)
+	}
+	return r.run("fetch")
+}
+
+// StageAll stages every change in the working tree that is not ignored.
+func (r *Repo) StageAll() error {
+	if r.Ignore == nil {
+		return r.run("add", "--all")
+	}
+	out, err := r.output("status", "--porcelain=v1", "-z", "--untracked-files=all")
+	if err != nil {
+		return fmt.Errorf("unable to get status (%w)", err)
+	}
+	paths := []string{}
+	for _, c := range r.unignored(parsePorcelain(out)) {
+		paths = append(paths, c.Path)
+		if c.From != "" {
+			paths = append(paths, c.From)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	return r.run(append([]string{"add", "--all", "--"}, paths...)...)
+}
+
+// unignored filters out the changes to ignored paths.
+func (r *Repo) unignored(changes []Change) []Change {
+	if r.Ignore == nil {
+		return changes
+	}
+	kept := []Change{}
+	for _, c := range changes {
+		if !r.Ignore(c.Path) {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+// Staged lists the staged changes, detecting renames.
+func (r *Repo) Staged() ([]Change, error) {
+	out, err := r.output("diff", "--cached", "--name-status", "--find-renames", "-z")
+	if err != nil {
+		return nil, fmt.Errorf("unable to list staged changes (%w)", err)
+	}
+	changes := []Change{}
+	fields := strings.Split(out, "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		c := Change{Code: fields[i][:1], Path: fields[i+1]}
+		if (c.Code == "R" || c.Code == "C") && i+2 < len(fields) {
+			c.From, c.Path = fields[i+1], fields[i+2]
+			i++
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// Commit commits the staged changes.
+func (r *Repo) Commit(message string) error {
+	return r.run("commit", "--quiet", "-m", message)
+}
+
+// Pull integrates the upstream's changes, by rebasing local commits onto it
+// or, if merge is set, by merging. Uncommitted changes are stashed meanwhile.
+// If pulling stops on conflicts, a *ConflictError is returned and the
+// rebase or merge is left in progress for the user to resolve.
+func (r *Repo) Pull(merge bool, current string) error {
+	args := []string{"pull", "--autostash", "--rebase"}
+	if merge {
+		args = []string{"pull", "--autostash", "--no-rebase", "--no-edit"}
+	}
+	if r.explicit() {
+		remote, branch := r.remoteAndBranch(current)
+		args = append(args, remote, branch)
+	}
+	err := r.run(args...)
+	if err == nil {
+		return nil
+	}
+	if conflicts, unmergedErr := r.Unmerged(); unmergedErr == nil && len(conflicts) > 0 {
+		return &ConflictError{Files: conflicts}
+	}
+	return err
+}
+
+// Unmerged lists the files with unresolved conflicts.
+func (r *Repo) Unmerged() ([]string, error) {
+	out, err := r.output("diff", "--name-only", "--diff-filter=U", "-z")
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for _, f := range strings.Split(out, "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// Push pushes to the upstream. If the remote refuses the update, a
+// *PushRejectedError is returned.
+func (r *Repo) Push(current string) error {
+	args := []string{"push"}
+	if r.explicit() {
+		remote, branch := r.remoteAndBranch(current)
+		args = append(args, remote, "HEAD:"+branch)
+	}
+	err := r.run(args...)
+	if err == nil {
+		return nil
+	}
+	var gitErr *Error
+	if errors.As(err, &gitErr) && strings.Contains(gitErr.Stderr, "[rejected]") {
+		return &PushRejectedError{Err: gitErr}
+	}
+	return err
+}
+
+// Clone clones url into dir, forwarding git's output to out (if non-nil).
+func Clone(url, dir string, out io.Writer) error {
+	return (&Repo{Output: out}).run("clone", url, dir)
+}
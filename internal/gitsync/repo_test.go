@@ -0,0 +1,92 @@
+package gitsync
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestParsePorcelain(t *testing.T) {
+	tests := []struct {
+		out  string
+		want []Change
+	}{
+		{"", []Change{}},
+		{" M a.md\x00", []Change{{Code: " M", Path: "a.md"}}},
+		{"?? new file.md\x00 D old.md\x00", []Change{{Code: "??", Path: "new file.md"}, {Code: " D", Path: "old.md"}}},
+		{"R  to.md\x00from.md\x00M  b.md\x00", []Change{{Code: "R ", Path: "to.md", From: "from.md"}, {Code: "M ", Path: "b.md"}}},
+		{"C  copy.md\x00orig.md\x00", []Change{{Code: "C ", Path: "copy.md", From: "orig.md"}}},
+	}
+	for _, tt := range tests {
+		if got := parsePorcelain(tt.out); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parsePorcelain(%q) = %v, want %v", tt.out, got, tt.want)
+		}
+	}
+}
+
+func TestStaged(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL=/dev/null", "GIT_CONFIG_NOSYSTEM=1")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(rel, content string) {
+		t.Helper()
+		if err := os.MkdirAll(path.Dir(path.Join(dir, rel)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path.Join(dir, rel), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "--quiet")
+	git("config", "user.name", "test")
+	git("config", "user.email", "test@example.com")
+	write("keep.md", "keep\n")
+	write("change.md", "before\n")
+	write("remove.md", "remove\n")
+	write("old name.md", "a file long enough to be found as renamed\n")
+	git("add", "--all")
+	git("commit", "--quiet", "-m", "init")
+
+	r := &Repo{Dir: dir}
+	changes, err := r.Staged()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Staged() = %v with nothing staged", changes)
+	}
+
+	write("change.md", "after\n")
+	write("dir/new.md", "new\n")
+	write("unstaged.md", "unstaged\n")
+	git("rm", "--quiet", "remove.md")
+	git("mv", "old name.md", "new name.md")
+	git("add", "change.md", "dir/new.md")
+
+	changes, err = r.Staged()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Change{
+		{Code: "M", Path: "change.md"},
+		{Code: "A", Path: "dir/new.md"},
+		{Code: "R", Path: "new name.md", From: "old name.md"},
+		{Code: "D", Path: "remove.md"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Staged() = %v, want %v", changes, want)
+	}
+}
@@ -0,0 +1,134 @@
+package gitsync
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Options configures a Sync. The zero value runs a full sync.
+type Options struct {
+	// Message builds the commit message for uncommitted local changes from
+	// the staged changes.
+	Message func(staged []Change) (string, error)
+	// Conflicts decides what happens when pulling hits conflicts.
+	Conflicts ConflictStrategy
+	// Merge pulls by merging rather than rebasing.
+	Merge bool
+	// NoCommit leaves uncommitted changes alone instead of committing them.
+	NoCommit bool
+	// NoPull skips pulling, NoPush skips pushing.
+	NoPull bool
+	NoPush bool
+	// DryRun only fetches; the result records what would have been done.
+	DryRun bool
+}
+
+// Result records what a Sync found and did (or, for a dry run, would do).
+type Result struct {
+	// Before is the state after fetching but before changing anything.
+	Before    Status
+	Committed bool
+	Pulled    bool
+	Pushed    bool
+	// Conflicts lists the conflicting files, if pulling stopped on conflicts.
+	Conflicts []string
+	// KeptBoth lists the files whose local and upstream versions were both
+	// kept, see KeepBoth.
+	KeptBoth []string
+}
+
+// Sync commits local changes, fetches, pulls from the upstream and pushes.
+//
+// The returned result is valid even when an error is returned, recording
+// the steps that succeeded before the failing one.
+func (r *Repo) Sync(opts Options) (*Result, error) {
+	res := &Result{}
+
+	if err := r.Fetch(); err != nil {
+		return res, fmt.Errorf("unable to fetch (%w)", err)
+	}
+	before, err := r.Status()
+	if err != nil {
+		return res, err
+	}
+	res.Before = *before
+
+	if len(before.Dirty) > 0 && !opts.NoCommit {
+		if !opts.DryRun {
+			if err := r.CommitAll(opts.Message); err != nil {
+				return res, fmt.Errorf("unable to commit local changes (%w)", err)
+			}
+		}
+		res.Committed = true
+	}
+
+	if before.Upstream == "" {
+		return res, ErrNoUpstream
+	}
+
+	if before.Behind > 0 && !opts.NoPull {
+		if !opts.DryRun {
+			if err := r.pull(opts, before, res); err != nil {
+				return res, fmt.Errorf("unable to pull (%w)", err)
+			}
+		}
+		res.Pulled = true
+	}
+
+	if (res.Committed || before.Ahead > 0) && !opts.NoPush {
+		if !opts.DryRun {
+			if err := r.Push(before.Branch); err != nil {
+				return res, fmt.Errorf("unable to push (%w)", err)
+			}
+		}
+		res.Pushed = true
+	}
+
+	return res, nil
+}
+
+// pull pulls, handling conflicts according to opts.Conflicts.
+func (r *Repo) pull(opts Options, before *Status, res *Result) error {
+	err := r.Pull(opts.Merge, before.Branch)
+	var conflictErr *ConflictError
+	if !errors.As(err, &conflictErr) {
+		return err
+	}
+	res.Conflicts = conflictErr.Files
+	if opts.Conflicts != KeepBoth {
+		return err
+	}
+
+	date := strings.Split(time.Now().Local().Format(time.RFC3339), "T")[0]
+	if opts.Merge {
+		res.KeptBoth, err = r.resolveKeepingBoth(hostname(), date)
+	} else {
+		res.KeptBoth, err = r.mergeKeepingBoth(before.Upstream, hostname(), date)
+	}
+	if err != nil {
+		return err
+	}
+	res.Conflicts = nil
+	return nil
+}
+
+// CommitAll stages and commits every change, with a message built from the
+// staged changes.
+func (r *Repo) CommitAll(message func([]Change) (string, error)) error {
+	if err := r.StageAll(); err != nil {
+		return err
+	}
+	staged, err := r.Staged()
+	if err != nil {
+		return err
+	}
+	msg := "Update"
+	if message != nil {
+		if msg, err = message(staged); err != nil {
+			return err
+		}
+	}
+	return r.Commit(msg)
+}
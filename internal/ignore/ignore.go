@@ -0,0 +1,216 @@
+// Package ignore decides which paths of a K are ignored, honouring the
+// .gitignore and .zignore files in it as well as globally configured
+// patterns, all in gitignore syntax.
+package ignore
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// The files patterns are read from, in each directory. Patterns in a .zignore
+// take precedence over those in the .gitignore next to it.
+var files = []string{".gitignore", ".zignore"}
+
+// rule is a single pattern.
+type rule struct {
+	base     string // directory the pattern is relative to, relative to the root
+	re       *regexp.Regexp
+	negate   bool
+	dirOnly  bool
+	anchored bool // matched against the path relative to base rather than the name
+}
+
+// Matcher decides which paths under a root are ignored. It reads ignore files
+// lazily and caches them, so it should not outlive changes to them.
+type Matcher struct {
+	root   string
+	global []rule
+
+	mu     sync.Mutex
+	perDir map[string][]rule
+}
+
+// New creates a matcher for the tree at root, with global patterns that are
+// relative to the root and apply before any ignore file in the tree.
+func New(root string, patterns []string) *Matcher {
+	m := &Matcher{root: root, perDir: map[string][]rule{}}
+	for _, p := range patterns {
+		if r, ok := parse("", p); ok {
+			m.global = append(m.global, r)
+		}
+	}
+	if f, err := os.Open(path.Join(root, ".git", "info", "exclude")); err == nil {
+		m.global = append(m.global, read("", f)...)
+		_ = f.Close()
+	}
+	return m
+}
+
+// Ignored tells whether a path relative to the root is ignored, either itself
+// or because one of the directories containing it is. The .git directory is
+// always ignored.
+func (m *Matcher) Ignored(rel string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	rel = path.Clean(strings.TrimPrefix(rel, "/"))
+	if rel == "." {
+		return false
+	}
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		if parts[i] == ".git" {
+			return true
+		}
+		last := i == len(parts)-1
+		if m.match(strings.Join(parts[:i+1], "/"), isDir || !last) {
+			return true
+		}
+	}
+	return false
+}
+
+// match tells whether the path itself is ignored, not considering its parent
+// directories. The last matching rule wins.
+func (m *Matcher) match(rel string, isDir bool) bool {
+	ignored := false
+	check := func(rules []rule) {
+		for _, r := range rules {
+			if r.matches(rel, isDir) {
+				ignored = !r.negate
+			}
+		}
+	}
+	check(m.global)
+	check(m.rules(""))
+	dir := ""
+	for _, part := range strings.Split(path.Dir(rel), "/") {
+		if part == "." {
+			break
+		}
+		dir = path.Join(dir, part)
+		check(m.rules(dir))
+	}
+	return ignored
+}
+
+// rules returns the rules of the ignore files in dir, reading them once.
+func (m *Matcher) rules(dir string) []rule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rules, ok := m.perDir[dir]; ok {
+		return rules
+	}
+	rules := []rule{}
+	for _, name := range files {
+		f, err := os.Open(path.Join(m.root, dir, name))
+		if err != nil {
+			continue
+		}
+		rules = append(rules, read(dir, f)...)
+		_ = f.Close()
+	}
+	m.perDir[dir] = rules
+	return rules
+}
+
+func read(base string, f *os.File) []rule {
+	rules := []rule{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if r, ok := parse(base, scanner.Text()); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// parse parses a line in gitignore syntax.
+func parse(base, line string) (rule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule{}, false
+	}
+	r := rule{base: base}
+	if strings.HasPrefix(line, "!") {
+		r.negate, line = true, line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly, line = true, strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule{}, false
+	}
+	r.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	re, err := regexp.Compile("^" + translate(line) + "$")
+	if err != nil {
+		return rule{}, false
+	}
+	r.re = re
+	return r, true
+}
+
+// translate turns a glob with gitignore's '**' into a regular expression.
+func translate(glob string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+func (r rule) matches(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	if r.anchored {
+		return r.re.MatchString(rel)
+	}
+	return r.re.MatchString(path.Base(rel))
+}
@@ -0,0 +1,96 @@
+package ignore
+
+import (
+	"os"
+	"path"
+	"regexp"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		glob  string
+		match []string
+		miss  []string
+	}{
+		{"*.log", []string{"a.log", ".log"}, []string{"a/b.log", "a.logx"}},
+		{"a?c", []string{"abc"}, []string{"ac", "a/c"}},
+		{"**/build", []string{"build", "a/build", "a/b/build"}, []string{"abuild", "build/a"}},
+		{"doc/**", []string{"doc/a", "doc/a/b"}, []string{"doc", "docs/a"}},
+		{"a/**/b", []string{"a/b", "a/x/b", "a/x/y/b"}, []string{"a/xb", "ab"}},
+		{"[abc].txt", []string{"a.txt", "c.txt"}, []string{"d.txt"}},
+		{"[!abc].txt", []string{"d.txt"}, []string{"a.txt"}},
+		{"[oops", []string{"[oops"}, []string{"o"}},
+		{`\*.txt`, []string{"*.txt"}, []string{"a.txt"}},
+		{"a.b", []string{"a.b"}, []string{"axb"}},
+	}
+	for _, tt := range tests {
+		re := regexp.MustCompile("^" + translate(tt.glob) + "$")
+		for _, s := range tt.match {
+			if !re.MatchString(s) {
+				t.Errorf("%q should match %q (regexp %q)", tt.glob, s, re)
+			}
+		}
+		for _, s := range tt.miss {
+			if re.MatchString(s) {
+				t.Errorf("%q should not match %q (regexp %q)", tt.glob, s, re)
+			}
+		}
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	root := t.TempDir()
+	write := func(rel, content string) {
+		t.Helper()
+		file := path.Join(root, rel)
+		if err := os.MkdirAll(path.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".gitignore", "# comment\n*.log\n!keep.log\nbuild/\n/top.txt\ndocs/*.pdf\n")
+	write(".zignore", "secret\n")
+	write("sub/.gitignore", "local\n!*.log\n")
+	write("sub/.zignore", "!local\n")
+
+	m := New(root, []string{"*.tmp"})
+	tests := []struct {
+		rel     string
+		isDir   bool
+		ignored bool
+	}{
+		{".", true, false},
+		{".git", true, true},
+		{".git/config", false, true},
+		{"a.tmp", false, true},
+		{"a.log", false, true},
+		{"x/a.log", false, true},
+		{"keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false}, // a file named like an ignored directory
+		{"build/out.o", false, true},
+		{"x/build/out.o", false, true},
+		{"top.txt", false, true},
+		{"x/top.txt", false, false},
+		{"docs/a.pdf", false, true},
+		{"docs/x/a.pdf", false, false},
+		{"secret", false, true},
+		{"sub/a.log", false, false}, // re-included by the nested .gitignore
+		{"sub/local", false, false}, // .zignore takes precedence over .gitignore
+		{"/a.log", false, true},
+		{"notes.md", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.Ignored(tt.rel, tt.isDir); got != tt.ignored {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", tt.rel, tt.isDir, got, tt.ignored)
+		}
+	}
+
+	var nilMatcher *Matcher
+	if nilMatcher.Ignored("a.log", false) {
+		t.Error("a nil matcher should ignore nothing")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package opener
+
+import "os/exec"
+
+// detachFromTerminal does nothing, sessions are a unix notion.
+func detachFromTerminal(cmd *exec.Cmd) {}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package opener
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachFromTerminal makes the command start in a session of its own, so it
+// outlives the terminal it was started from.
+func detachFromTerminal(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
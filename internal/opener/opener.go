@@ -0,0 +1,184 @@
+// Package opener finds and runs the commands files are opened and previewed
+// with.
+package opener
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+
+	"z/internal/cfg"
+	"z/internal/sniff"
+)
+
+// Defaults are the openers tried after the configured ones. Apart from
+// formats that need a specific program, files are dispatched on their
+// sniffed class, so files with a missing or wrong extension still work.
+var Defaults = []cfg.Opener{
+	{
+		Extensions: []string{"xopp"},
+		Open:       "xournalpp {{quote .Path}}",
+	},
+	{
+		Classes: []string{string(sniff.Text)},
+		Open:    "nvim{{if .Line}} '+call cursor({{.Line}}, {{or .Column 1}})'{{end}}{{range .Paths}} {{quote .}}{{end}}",
+		Batch:   true,
+		Preview: "bat --color always --decorations never {{quote .Path}}",
+	},
+	{
+		Classes: []string{string(sniff.Image)},
+		Open:    "feh --image-bg=white{{range .Paths}} {{quote .}}{{end}}",
+		Batch:   true,
+		Preview: "catimg -w $(( {{.Width}} * 2 )) {{quote .Path}}",
+	},
+	{
+		Classes: []string{string(sniff.PDF)},
+		Open:    "zathura {{if .Page}}--page={{.Page}} {{end}}{{quote .Path}}",
+		Preview: "pdftotext {{quote .Path}} -",
+	},
+	{
+		Classes: []string{string(sniff.HTML)},
+		Open:    "firefox {{quote .Path}}",
+		Preview: "w3m -dump {{quote .Path}} -cols {{.Width}}",
+	},
+	{
+		Classes: []string{string(sniff.Archive)},
+		Preview: "{{if eq .Ext \"zip\"}}unzip -l{{else}}tar -tvf{{end}} {{quote .Path}}",
+	},
+}
+
+// Data is the data passed to opener templates.
+type Data struct {
+	Path   string   // absolute path of the file
+	Paths  []string // absolute paths of all files, when opening a batch
+	Dir    string   // directory containing the file
+	Name   string   // file name
+	Ext    string   // extension, without the dot
+	Class  string   // sniffed class of the content
+	MIME   string   // sniffed MIME type
+	Page   int      // page to open at, 0 if none
+	Line   int      // line to open at, 0 if none (for a batch, in the first file)
+	Column int      // column to open at, 0 if none
+	Width  int      // terminal width, for previews
+	Height int      // terminal height, for previews
+}
+
+// DataFor builds the template data for a file of a sniffed type.
+func DataFor(file string, t sniff.Type) Data {
+	return Data{
+		Path:  file,
+		Paths: []string{file},
+		Dir:   path.Dir(file),
+		Name:  path.Base(file),
+		Ext:   extension(file),
+		Class: string(t.Class),
+		MIME:  t.MIME,
+	}
+}
+
+// A Registry is an ordered list of openers, the first matching one wins.
+type Registry []cfg.Opener
+
+// New creates a registry of the configured openers, falling back to the
+// defaults.
+func New(configured []cfg.Opener) Registry {
+	return append(slices.Clone(configured), Defaults...)
+}
+
+// Opener finds the first opener matching the file that can open it.
+func (r Registry) Opener(file string, t sniff.Type) (cfg.Opener, bool) {
+	return r.find(file, t, func(o cfg.Opener) bool { return o.Open != "" })
+}
+
+// Previewer finds the first opener matching the file that can preview it.
+func (r Registry) Previewer(file string, t sniff.Type) (cfg.Opener, bool) {
+	return r.find(file, t, func(o cfg.Opener) bool { return o.Preview != "" })
+}
+
+func (r Registry) find(file string, t sniff.Type, can func(cfg.Opener) bool) (cfg.Opener, bool) {
+	for _, o := range r {
+		if can(o) && Matches(o, file, t) {
+			return o, true
+		}
+	}
+	return cfg.Opener{}, false
+}
+
+// Matches tells whether an opener matches a file of a sniffed type by its
+// extension, a glob, its MIME type or its class.
+func Matches(o cfg.Opener, file string, t sniff.Type) bool {
+	ext := extension(file)
+	for _, e := range o.Extensions {
+		if strings.EqualFold(strings.TrimPrefix(e, "."), ext) {
+			return true
+		}
+	}
+	for _, glob := range o.Globs {
+		name := path.Base(file)
+		if strings.Contains(glob, "/") {
+			name = file
+		}
+		if ok, _ := path.Match(glob, name); ok {
+			return true
+		}
+	}
+	for _, m := range o.MIME {
+		if matchMIME(m, t.MIME) {
+			return true
+		}
+	}
+	for _, class := range o.Classes {
+		if sniff.Class(class) == t.Class {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMIME matches a MIME type against a pattern like 'image/png' or
+// 'image/*'.
+func matchMIME(pattern, mimeType string) bool {
+	if mimeType == "" {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mimeType, prefix+"/")
+	}
+	return strings.EqualFold(pattern, mimeType)
+}
+
+func extension(file string) string {
+	return strings.ToLower(strings.TrimPrefix(path.Ext(file), "."))
+}
+
+// Command fills a command template and returns the command running it with
+// bash.
+func Command(tmpl string, data Data) (*exec.Cmd, error) {
+	t, err := template.New("opener").Funcs(cfg.CommandFuncs).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse command template '%s' (%s)", tmpl, err.Error())
+	}
+	cmdline := strings.Builder{}
+	if err := t.Execute(&cmdline, data); err != nil {
+		return nil, fmt.Errorf("could not fill command template '%s' (%s)", tmpl, err.Error())
+	}
+	return exec.Command("bash", "-c", cmdline.String()), nil
+}
+
+// Run runs a command in the foreground, attached to the terminal, or, if
+// detach is set, starts it in its own session and returns right away.
+func Run(cmd *exec.Cmd, detach bool) error {
+	if !detach {
+		cmd.Stdout, cmd.Stderr, cmd.Stdin = os.Stdout, os.Stderr, os.Stdin
+		return cmd.Run()
+	}
+	detachFromTerminal(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
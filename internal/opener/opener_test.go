@@ -0,0 +1,111 @@
+package opener
+
+import (
+	"reflect"
+	"testing"
+
+	"z/internal/cfg"
+	"z/internal/sniff"
+)
+
+func TestMatches(t *testing.T) {
+	text := sniff.Type{Class: sniff.Text, MIME: "text/markdown"}
+	png := sniff.Type{Class: sniff.Image, MIME: "image/png"}
+	tests := []struct {
+		opener cfg.Opener
+		file   string
+		t      sniff.Type
+		want   bool
+	}{
+		{cfg.Opener{Extensions: []string{"md"}}, "/k/note.md", text, true},
+		{cfg.Opener{Extensions: []string{".MD"}}, "/k/note.md", text, true},
+		{cfg.Opener{Extensions: []string{"md"}}, "/k/note.md.bak", text, false},
+		{cfg.Opener{Extensions: []string{"md"}}, "/k/md", text, false},
+		{cfg.Opener{Globs: []string{"*.tar.gz"}}, "/k/a.tar.gz", sniff.Type{Class: sniff.Archive}, true},
+		{cfg.Opener{Globs: []string{"Makefile"}}, "/k/sub/Makefile", text, true},
+		{cfg.Opener{Globs: []string{"/k/*/Makefile"}}, "/k/sub/Makefile", text, true},
+		{cfg.Opener{Globs: []string{"/k/*/Makefile"}}, "/k/sub/deeper/Makefile", text, false},
+		{cfg.Opener{MIME: []string{"image/*"}}, "/k/a.png", png, true},
+		{cfg.Opener{MIME: []string{"IMAGE/PNG"}}, "/k/a", png, true},
+		{cfg.Opener{MIME: []string{"image/jpeg"}}, "/k/a.png", png, false},
+		{cfg.Opener{MIME: []string{"image/*"}}, "/k/a.png", sniff.Type{Class: sniff.Binary}, false},
+		{cfg.Opener{Classes: []string{"image"}}, "/k/a.md", png, true},
+		{cfg.Opener{Classes: []string{"image", "pdf"}}, "/k/a.png", text, false},
+		{cfg.Opener{}, "/k/note.md", text, false},
+	}
+	for _, tt := range tests {
+		if got := Matches(tt.opener, tt.file, tt.t); got != tt.want {
+			t.Errorf("Matches(%+v, %q, %+v) = %v, want %v", tt.opener, tt.file, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := New([]cfg.Opener{
+		{Extensions: []string{"md"}, Preview: "glow {{quote .Path}}"},
+		{Globs: []string{"*.pdf"}, Open: "evince {{quote .Path}}"},
+	})
+	tests := []struct {
+		file            string
+		t               sniff.Type
+		open, preview   string
+		canOpen, canSee bool
+	}{
+		// the configured openers come first, falling back to the defaults
+		// for what they can't do
+		{"/k/a.md", sniff.Type{Class: sniff.Text}, Defaults[1].Open, "glow {{quote .Path}}", true, true},
+		{"/k/a.pdf", sniff.Type{Class: sniff.PDF}, "evince {{quote .Path}}", Defaults[3].Preview, true, true},
+		{"/k/a.xopp", sniff.Type{Class: sniff.Archive}, Defaults[0].Open, Defaults[5].Preview, true, true},
+		{"/k/no-extension", sniff.Type{Class: sniff.Image}, Defaults[2].Open, Defaults[2].Preview, true, true},
+		{"/k/a.bin", sniff.Type{Class: sniff.Binary}, "", "", false, false},
+	}
+	for _, tt := range tests {
+		o, ok := r.Opener(tt.file, tt.t)
+		if ok != tt.canOpen || o.Open != tt.open {
+			t.Errorf("Opener(%q) = %q, %v, want %q, %v", tt.file, o.Open, ok, tt.open, tt.canOpen)
+		}
+		o, ok = r.Previewer(tt.file, tt.t)
+		if ok != tt.canSee || o.Preview != tt.preview {
+			t.Errorf("Previewer(%q) = %q, %v, want %q, %v", tt.file, o.Preview, ok, tt.preview, tt.canSee)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	data := DataFor("/k/it's here/doc.PDF", sniff.Type{Class: sniff.PDF, MIME: "application/pdf"})
+	data.Page = 3
+	want := Data{Path: "/k/it's here/doc.PDF", Paths: []string{"/k/it's here/doc.PDF"}, Dir: "/k/it's here", Name: "doc.PDF", Ext: "pdf", Class: "pdf", MIME: "application/pdf", Page: 3}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("DataFor() = %+v, want %+v", data, want)
+	}
+
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{Defaults[3].Open, `zathura --page=3 '/k/it'\''s here/doc.PDF'`},
+		{Defaults[1].Open, `nvim '/k/it'\''s here/doc.PDF'`},
+		{"cd {{quote .Dir}} && open {{.Name}}.{{.Ext}} as {{.Class}}", `cd '/k/it'\''s here' && open doc.PDF.pdf as pdf`},
+	}
+	for _, tt := range tests {
+		cmd, err := Command(tt.tmpl, data)
+		if err != nil {
+			t.Errorf("Command(%q) failed (%s)", tt.tmpl, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(cmd.Args, []string{"bash", "-c", tt.want}) {
+			t.Errorf("Command(%q) runs %q, want %q", tt.tmpl, cmd.Args, tt.want)
+		}
+	}
+	data.Paths = []string{"/k/a.md", "/k/b c.md"}
+	if cmd, err := Command(Defaults[1].Open, data); err != nil {
+		t.Errorf("Command() of a batch failed (%s)", err.Error())
+	} else if cmd.Args[2] != `nvim '/k/a.md' '/k/b c.md'` {
+		t.Errorf("Command() of a batch runs %q", cmd.Args)
+	}
+	for _, tmpl := range []string{"open {{.Path", "open {{.Nope}}"} {
+		if _, err := Command(tmpl, data); err == nil {
+			t.Errorf("Command(%q) succeeded", tmpl)
+		}
+	}
+}
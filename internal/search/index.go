@@ -0,0 +1,282 @@
+// Package search provides a full-text index of the files in a K.
+//
+// The index of each K is cached under the user's cache directory and kept up
+// to date incrementally, re-reading only the files whose modification time
+// or size changed since the last update.
+package search
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"z/internal/extract"
+	"z/internal/ignore"
+
+	"github.com/rs/zerolog/log"
+)
+
+// formatVersion is bumped whenever the on-disk format changes, which makes
+// existing caches be rebuilt.
+const formatVersion = 3
+
+// maxFileSize is the size above which text files are not indexed, and
+// maxExtractSize the one for files text is extracted from.
+const (
+	maxFileSize    = 4 << 20
+	maxExtractSize = 64 << 20
+)
+
+// Doc is an indexed file.
+type Doc struct {
+	ModTime time.Time
+	Size    int64
+	Lines   []string
+	// Extracted is set if Lines were extracted from a non-text document,
+	// in which case Pages holds the page number of each line and FileLines
+	// the line of the file it is on, or 0 if the document has no lines.
+	Extracted bool
+	Pages     []int
+	FileLines []int
+}
+
+// Index is the full-text index of a single K.
+type Index struct {
+	Version int
+	Root    string
+	// Docs are the indexed files, by path relative to Root.
+	Docs map[string]*Doc
+	// Terms maps each term to the files and (1-based) lines it occurs in.
+	Terms map[string]map[string][]int
+
+	file    string
+	ignored *ignore.Matcher
+	changed bool
+}
+
+// CacheFile is where the index of a K is stored. The K's ID is escaped, so
+// that no ID leads out of the cache dir.
+func CacheFile(kID string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine cache dir (%w)", err)
+	}
+	return path.Join(dir, "z", "index", url.PathEscape(kID)+".gob"), nil
+}
+
+// Open loads the cached index of a K rooted at root, brings it up to date
+// and saves it if anything changed. A missing or outdated cache is rebuilt.
+func Open(kID, root string, ignored *ignore.Matcher) (*Index, error) {
+	file, err := CacheFile(kID)
+	if err != nil {
+		return nil, err
+	}
+	idx := load(file)
+	if idx == nil || idx.Version != formatVersion || idx.Root != root {
+		idx = &Index{Version: formatVersion, Root: root, Docs: map[string]*Doc{}, Terms: map[string]map[string][]int{}}
+		idx.changed = true
+	}
+	idx.file, idx.ignored = file, ignored
+	if err := idx.Update(); err != nil {
+		return nil, err
+	}
+	if idx.changed {
+		if err := idx.Save(); err != nil {
+			return nil, err
+		}
+	}
+	return idx, nil
+}
+
+// load reads a cached index, returning nil if there is none usable.
+func load(file string) *Index {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	idx := &Index{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(idx); err != nil {
+		return nil
+	}
+	return idx
+}
+
+// Save writes the index to its cache file.
+func (idx *Index) Save() error {
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(idx); err != nil {
+		return fmt.Errorf("unable to encode index (%w)", err)
+	}
+	if err := os.MkdirAll(path.Dir(idx.file), 0755); err != nil {
+		return fmt.Errorf("unable to create cache dir (%w)", err)
+	}
+	// a temporary file of its own, as the daemon and a search may both save
+	tmp, err := os.CreateTemp(path.Dir(idx.file), path.Base(idx.file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("unable to write index (%w)", err)
+	}
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), idx.file)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return fmt.Errorf("unable to write index (%w)", err)
+	}
+	idx.changed = false
+	return nil
+}
+
+// Update re-indexes the files that changed since the last update and drops
+// the ones that are gone. A root that is a symlink is followed.
+func (idx *Index) Update() error {
+	root, err := filepath.EvalSymlinks(idx.Root)
+	if err != nil {
+		return fmt.Errorf("unable to resolve '%s' (%w)", idx.Root, err)
+	}
+	seen := map[string]bool{}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		if p != root && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		if p != root && idx.ignored.Ignored(filepath.ToSlash(rel), d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		seen[rel] = true
+		if doc, ok := idx.Docs[rel]; ok && doc.ModTime.Equal(info.ModTime()) && doc.Size == info.Size() {
+			return nil
+		}
+		idx.remove(rel)
+		doc := &Doc{ModTime: info.ModTime(), Size: info.Size()}
+		if _, ok := extract.For(p); ok {
+			doc.Extracted = true
+			doc.Lines, doc.Pages, doc.FileLines = readExtracted(p, info.Size())
+		} else {
+			doc.Lines = readText(p, info.Size())
+		}
+		// non-text files are kept without lines, so they aren't re-read every time
+		idx.add(rel, doc)
+		idx.changed = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to walk '%s' (%w)", idx.Root, err)
+	}
+	for rel := range idx.Docs {
+		if !seen[rel] {
+			idx.remove(rel)
+			idx.changed = true
+		}
+	}
+	return nil
+}
+
+// readText reads a file's lines, if it is a reasonably sized text file.
+func readText(p string, size int64) []string {
+	if size > maxFileSize {
+		return nil
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+}
+
+// readExtracted extracts a document's lines, along with the page and the
+// line of the file of each.
+func readExtracted(p string, size int64) ([]string, []int, []int) {
+	if size > maxExtractSize {
+		return nil, nil, nil
+	}
+	extracted, err := extract.Text(p)
+	if err != nil {
+		log.Debug().Err(err).Str("file", p).Msg("could not extract text, not indexing it")
+		return nil, nil, nil
+	}
+	lines, pages, fileLines := []string{}, []int{}, []int{}
+	for _, page := range extracted {
+		for i, line := range strings.Split(page.Text, "\n") {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			lines = append(lines, strings.TrimSpace(line))
+			pages = append(pages, page.Number)
+			fileLine := 0
+			if page.Line > 0 {
+				fileLine = page.Line + i
+			}
+			fileLines = append(fileLines, fileLine)
+		}
+	}
+	return lines, pages, fileLines
+}
+
+func (idx *Index) add(rel string, doc *Doc) {
+	idx.Docs[rel] = doc
+	for i, line := range doc.Lines {
+		for _, term := range uniqueTerms(line) {
+			files, ok := idx.Terms[term]
+			if !ok {
+				files = map[string][]int{}
+				idx.Terms[term] = files
+			}
+			files[rel] = append(files[rel], i+1)
+		}
+	}
+}
+
+func (idx *Index) remove(rel string) {
+	doc, ok := idx.Docs[rel]
+	if !ok {
+		return
+	}
+	delete(idx.Docs, rel)
+	for _, line := range doc.Lines {
+		for _, term := range uniqueTerms(line) {
+			if files, ok := idx.Terms[term]; ok {
+				delete(files, rel)
+				if len(files) == 0 {
+					delete(idx.Terms, term)
+				}
+			}
+		}
+	}
+}
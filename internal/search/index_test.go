@@ -0,0 +1,113 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useCacheDir makes the indexes be cached in a fresh dir.
+func useCacheDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("HOME", dir)
+	return dir
+}
+
+func writeFile(t *testing.T, p, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheFile(t *testing.T) {
+	cache := useCacheDir(t)
+	for _, kID := range []string{"notes", "../../escape", "a/b", ".."} {
+		file, err := CacheFile(kID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Dir(file) != filepath.Join(cache, "z", "index") {
+			t.Errorf("CacheFile(%q) = %q, which is not in the index dir", kID, file)
+		}
+	}
+	a, _ := CacheFile("a/b")
+	b, _ := CacheFile("a%2Fb")
+	if a == b {
+		t.Errorf("different K IDs share the cache file %q", a)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	useCacheDir(t)
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.md"), "# Apples\n\nred and green\n")
+	writeFile(t, filepath.Join(root, "sub", "b.md"), "bananas are yellow\n")
+	writeFile(t, filepath.Join(root, ".z", "z.yml"), "apples: hidden\n")
+	writeFile(t, filepath.Join(root, "bin"), "apples\x00")
+
+	idx, err := Open("k", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files := idx.Terms["apples"]; len(files) != 1 || len(files["a.md"]) != 1 || files["a.md"][0] != 1 {
+		t.Errorf("'apples' is indexed as %v, want only in a.md:1", files)
+	}
+	if _, ok := idx.Terms["bananas"][filepath.Join("sub", "b.md")]; !ok {
+		t.Errorf("files in subdirs are not indexed")
+	}
+	file, _ := CacheFile("k")
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("the index was not saved (%s)", err.Error())
+	}
+	if tmps, _ := filepath.Glob(file + ".*.tmp"); len(tmps) != 0 {
+		t.Errorf("temporary files were left behind: %v", tmps)
+	}
+
+	// changed, removed and added files are picked up when reopening
+	writeFile(t, filepath.Join(root, "a.md"), "# Cherries\n")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "a.md"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(root, "sub", "b.md")); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(root, "c.md"), "dates\n")
+	idx, err = Open("k", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for term, want := range map[string]bool{"apples": false, "bananas": false, "cherries": true, "dates": true} {
+		if _, ok := idx.Terms[term]; ok != want {
+			t.Errorf("'%s' indexed: %v, want %v", term, ok, want)
+		}
+	}
+	if _, ok := idx.Docs[filepath.Join("sub", "b.md")]; ok {
+		t.Errorf("removed file is still indexed")
+	}
+}
+
+func TestOpenSymlinkedRoot(t *testing.T) {
+	useCacheDir(t)
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "real", "a.md"), "apples\n")
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(filepath.Join(dir, "real"), link); err != nil {
+		t.Skip("unable to create symlinks")
+	}
+	idx, err := Open("k", link, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits := idx.Search("apples"); len(hits) != 1 || !strings.HasSuffix(hits[0].File, "a.md") {
+		t.Errorf("Search() = %v, want a hit in a.md", hits)
+	}
+}
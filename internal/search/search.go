@@ -0,0 +1,143 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Hit is a line matching a query.
+type Hit struct {
+	File  string // relative to the K
+	Line  int    // 1-based, or 0 if the text was extracted from a document without lines, like a PDF
+	Page  int    // for text extracted from a document, the page it is on (if paged)
+	Text  string
+	Score float64
+}
+
+// terms splits text into lowercase terms of letters and digits.
+func terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// uniqueTerms is terms without duplicates.
+func uniqueTerms(text string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, t := range terms(text) {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// Search returns the lines matching the query, best first.
+//
+// A query term matches a term in the index that it is a prefix of, exact
+// matches counting more. Lines are ranked by the rarity of the query terms
+// they contain, with lines containing all of them, and lines containing the
+// query verbatim, first.
+func (idx *Index) Search(query string) []Hit {
+	queryTerms := uniqueTerms(query)
+	if len(queryTerms) == 0 {
+		return []Hit{}
+	}
+	phrase := strings.ToLower(strings.TrimSpace(query))
+
+	type lineKey struct {
+		file string
+		line int
+	}
+	scores := map[lineKey]float64{}
+	matched := map[lineKey]int{}
+	for _, q := range queryTerms {
+		best := map[lineKey]float64{}
+		for term, files := range idx.Terms {
+			if !strings.HasPrefix(term, q) {
+				continue
+			}
+			weight := idx.idf(len(files))
+			if term != q {
+				weight /= 2
+			}
+			for file, lines := range files {
+				for _, line := range lines {
+					key := lineKey{file, line}
+					best[key] = math.Max(best[key], weight)
+				}
+			}
+		}
+		for key, weight := range best {
+			scores[key] += weight
+			matched[key]++
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for key, score := range scores {
+		hit := idx.Docs[key.file].hit(key.file, key.line)
+		if matched[key] == len(queryTerms) {
+			score *= 2
+		}
+		if strings.Contains(strings.ToLower(hit.Text), phrase) {
+			score *= 2
+		}
+		hit.Score = score
+		hits = append(hits, hit)
+	}
+	SortHits(hits)
+	return hits
+}
+
+// idf is the inverse document frequency of a term found in n files.
+func (idx *Index) idf(n int) float64 {
+	return math.Log(1 + float64(len(idx.Docs))/float64(n))
+}
+
+// SortHits sorts hits best first, and by file and line among equals.
+func SortHits(hits []Hit) {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].File != hits[j].File {
+			return hits[i].File < hits[j].File
+		}
+		return hits[i].Line < hits[j].Line
+	})
+}
+
+// hit describes the (1-based) line of a doc.
+func (doc *Doc) hit(file string, line int) Hit {
+	hit := Hit{File: file, Line: line, Text: doc.Lines[line-1]}
+	if doc.Extracted {
+		hit.Line, hit.Page = doc.FileLines[line-1], doc.Pages[line-1]
+	}
+	return hit
+}
+
+// Lines calls fn for every non-empty line of every indexed file, in order.
+func (idx *Index) Lines(fn func(Hit) error) error {
+	files := make([]string, 0, len(idx.Docs))
+	for file := range idx.Docs {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		doc := idx.Docs[file]
+		for i, text := range doc.Lines {
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			if err := fn(doc.hit(file, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
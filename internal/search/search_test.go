@@ -0,0 +1,87 @@
+package search
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	useCacheDir(t)
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "a.md"), "green apples\napple pie\nnothing here\n")
+	writeFile(t, filepath.Join(root, "b.md"), "Green Apples are sour\ngreen\n")
+	writeFile(t, filepath.Join(root, "c.md"), "apples and green pears\n")
+	idx, err := Open("k", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type hit struct {
+		file string
+		line int
+	}
+	tests := []struct {
+		query string
+		want  []hit
+	}{
+		{"", []hit{}},
+		{"  ", []hit{}},
+		{"kiwi", []hit{}},
+		// verbatim matches first, then lines with all terms, then the rest
+		{"green apples", []hit{{"a.md", 1}, {"b.md", 1}, {"c.md", 1}, {"b.md", 2}}},
+		// exact terms count more than those the query is a prefix of
+		{"apple", []hit{{"a.md", 2}, {"a.md", 1}, {"b.md", 1}, {"c.md", 1}}},
+	}
+	for _, tt := range tests {
+		hits := idx.Search(tt.query)
+		got := []hit{}
+		for _, h := range hits {
+			got = append(got, hit{h.File, h.Line})
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	if hits := idx.Search("pie"); len(hits) != 1 || hits[0].Text != "apple pie" {
+		t.Errorf("Search(\"pie\") = %v, want the line \"apple pie\"", hits)
+	}
+}
+
+func TestLines(t *testing.T) {
+	useCacheDir(t)
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "b.md"), "two\n")
+	writeFile(t, filepath.Join(root, "a.md"), "one\n\n  \nthree\n")
+	idx, err := Open("k", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	err = idx.Lines(func(h Hit) error {
+		got = append(got, fmt.Sprintf("%s:%d:%s", h.File, h.Line, h.Text))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.md:1:one", "a.md:4:three", "b.md:1:two"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines() visited %v, want %v", got, want)
+	}
+}
+
+func TestSearchExtracted(t *testing.T) {
+	useCacheDir(t)
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "page.html"), "<html>\n<body>\n<p>\nsome <b>apples</b>\n</p>\n</body>\n</html>\n")
+	idx, err := Open("k", root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits := idx.Search("apples")
+	if len(hits) != 1 || hits[0].Line != 4 || hits[0].Page != 0 || hits[0].Text != "some apples" {
+		t.Errorf("Search() = %+v, want a hit on line 4 of page.html", hits)
+	}
+}
@@ -0,0 +1,171 @@
+// Package sniff classifies files by their content, falling back to their
+// extension where the content is ambiguous.
+package sniff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// A Class is a coarse kind of file content.
+type Class string
+
+// The classes files are sniffed into.
+const (
+	Text    Class = "text"
+	Image   Class = "image"
+	PDF     Class = "pdf"
+	HTML    Class = "html"
+	Archive Class = "archive"
+	Binary  Class = "binary"
+)
+
+// sniffLen is how much of a file is looked at, enough for the tar magic.
+const sniffLen = 512
+
+// Type is what a file was sniffed to be.
+type Type struct {
+	Class Class
+	MIME  string // without parameters, e.g. 'image/png'
+}
+
+// File sniffs the type of the file at the given path.
+func File(file string) (Type, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Type{}, err
+	}
+	defer func() { _ = f.Close() }()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return Type{}, err
+	}
+	return Detect(file, head[:n]), nil
+}
+
+// Detect sniffs the type of a file from its name and the first bytes of its
+// content.
+func Detect(name string, head []byte) Type {
+	ext := strings.ToLower(path.Ext(name))
+	t := Type{Class: classOf(ext, head)}
+	t.MIME, _, _ = strings.Cut(mime.TypeByExtension(ext), ";")
+	if claimed := classOf(ext, nil); t.MIME == "" || len(head) > 0 && claimed != Text && claimed != t.Class {
+		// the extension is unknown or claims a class the content is not of
+		t.MIME, _, _ = strings.Cut(http.DetectContentType(head), ";")
+	}
+	return t
+}
+
+// magic numbers of binary formats, by class
+var magic = []struct {
+	offset int
+	prefix string
+	class  Class
+	valid  func(head []byte) bool // further checks, for short magics a text may start with
+}{
+	{0, "%PDF-", PDF, nil},
+	{0, "\x89PNG\r\n\x1a\n", Image, nil},
+	{0, "\xff\xd8\xff", Image, nil},
+	{0, "GIF87a", Image, nil},
+	{0, "GIF89a", Image, nil},
+	{0, "II*\x00", Image, nil},
+	{0, "MM\x00*", Image, nil},
+	{0, "BM", Image, isBMP},
+	{0, "RIFF", Image, isWEBP},
+	{0, "PK\x03\x04", Archive, nil},
+	{0, "PK\x05\x06", Archive, nil},
+	{0, "\x1f\x8b", Archive, nil},
+	{0, "\xfd7zXZ\x00", Archive, nil},
+	{0, "BZh", Archive, isBzip2},
+	{0, "7z\xbc\xaf\x27\x1c", Archive, nil},
+	{0, "\x28\xb5\x2f\xfd", Archive, nil},
+	{257, "ustar", Archive, nil},
+}
+
+// isBMP checks the rest of the BMP file header: the reserved fields are zero
+// and the pixel data starts after at least the smallest info header.
+func isBMP(head []byte) bool {
+	if len(head) < 14 || string(head[6:10]) != "\x00\x00\x00\x00" {
+		return false
+	}
+	return binary.LittleEndian.Uint32(head[10:14]) >= 26
+}
+
+// isWEBP checks that the RIFF container holds a WEBP image.
+func isWEBP(head []byte) bool {
+	return len(head) >= 12 && string(head[8:12]) == "WEBP"
+}
+
+// isBzip2 checks for the block size and the magic of the first block, or of
+// the end of an empty stream.
+func isBzip2(head []byte) bool {
+	if len(head) < 10 || head[3] < '1' || head[3] > '9' {
+		return false
+	}
+	block := string(head[4:10])
+	return block == "1AY&SY" || block == "\x17\x72\x45\x38\x50\x90"
+}
+
+func classOf(ext string, head []byte) Class {
+	if len(head) == 0 {
+		// nothing to sniff, trust the extension
+		switch ext {
+		case ".pdf":
+			return PDF
+		case ".html", ".htm":
+			return HTML
+		}
+		if strings.HasPrefix(mime.TypeByExtension(ext), "image/") {
+			return Image
+		}
+		return Text
+	}
+	for _, m := range magic {
+		if len(head) >= m.offset+len(m.prefix) && string(head[m.offset:m.offset+len(m.prefix)]) == m.prefix && (m.valid == nil || m.valid(head)) {
+			return m.class
+		}
+	}
+	if !isText(head) {
+		return Binary
+	}
+	switch {
+	case ext == ".html" || ext == ".htm" || looksLikeHTML(head):
+		return HTML
+	case ext == ".svg":
+		return Image
+	}
+	return Text
+}
+
+// isText tells whether the content is UTF-8 without NUL bytes, tolerating a
+// rune cut off at the end.
+func isText(head []byte) bool {
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+	if len(head) == sniffLen {
+		for i := len(head) - 1; i >= 0 && i >= len(head)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(head[i]) {
+				if !utf8.FullRune(head[i:]) {
+					head = head[:i]
+				}
+				break
+			}
+		}
+	}
+	return utf8.Valid(head)
+}
+
+func looksLikeHTML(head []byte) bool {
+	s := strings.ToLower(strings.TrimLeft(string(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))), " \t\r\n"))
+	return strings.HasPrefix(s, "<!doctype html") || strings.HasPrefix(s, "<html")
+}
@@ -0,0 +1,51 @@
+package sniff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	bmp := "BM\x36\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00\x28\x00\x00\x00"
+	webp := "RIFF\x24\x00\x00\x00WEBPVP8 "
+	wav := "RIFF\x24\x00\x00\x00WAVEfmt \x10\x00\x00\x00\x01\x00"
+	bzip2 := "BZh91AY&SY\x4e\xec\xe8\x36"
+	tests := []struct {
+		name  string
+		head  string
+		class Class
+		mime  string // checked if not empty, the system's MIME types vary
+	}{
+		{"notes.md", "# Notes\n", Text, ""},
+		{"notes", "plain text\n", Text, "text/plain"},
+		{"bmw.md", "BMW repair notes\n", Text, ""},
+		{"bzh.txt", "BZh is how bzip2 files start\n", Text, ""},
+		{"riff.txt", "RIFF and WEBP are both container formats\n", Text, ""},
+		{"image.bmp", bmp, Image, "image/bmp"},
+		{"image.webp", webp, Image, "image/webp"},
+		{"sound.wav", wav, Binary, ""},
+		{"archive.bz2", bzip2, Archive, ""},
+		{"image.png", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", Image, "image/png"},
+		{"photo.png", "\xff\xd8\xff\xe0\x00\x10JFIF\x00", Image, "image/png"},
+		{"doc.pdf", "%PDF-1.7\n", PDF, "application/pdf"},
+		{"doc.pdf", "", PDF, "application/pdf"},
+		{"page.html", "<p>hi</p>", HTML, "text/html"},
+		{"page", "<!DOCTYPE html><html></html>", HTML, "text/html"},
+		{"drawing.svg", "<svg xmlns=\"http://www.w3.org/2000/svg\"/>", Image, ""},
+		{"a.zip", "PK\x03\x04\x14\x00", Archive, ""},
+		{"a.tar", strings.Repeat("\x00", 257) + "ustar\x0000", Archive, ""},
+		{"data", "\x00\x01\x02\x03", Binary, "application/octet-stream"},
+		{"fake.pdf", "just text\n", Text, "text/plain"},
+		{"fake.png", "<html><body></body></html>", HTML, "text/html"},
+		{"cut.txt", strings.Repeat("a", sniffLen-1) + "\xc3", Text, ""},
+	}
+	for _, tt := range tests {
+		got := Detect(tt.name, []byte(tt.head))
+		if got.Class != tt.class {
+			t.Errorf("Detect(%q, %q).Class = %q, want %q", tt.name, tt.head, got.Class, tt.class)
+		}
+		if tt.mime != "" && got.MIME != tt.mime {
+			t.Errorf("Detect(%q, %q).MIME = %q, want %q", tt.name, tt.head, got.MIME, tt.mime)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+// Package watch watches directory trees for changes.
+package watch
+
+import "errors"
+
+// ErrUnsupported is returned by New on platforms without a watcher backend.
+var ErrUnsupported = errors.New("watching files is not supported on this platform")
+
+// Skip decides whether a directory (and everything below it) is not
+// watched.
+type Skip func(dir string) bool
@@ -0,0 +1,141 @@
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// events are the inotify events that indicate a change to a tree.
+const events = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MODIFY | unix.IN_CLOSE_WRITE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF
+
+// Watcher watches directory trees with inotify, following directories as
+// they are created.
+type Watcher struct {
+	fd   int
+	file *os.File // wraps fd for reading through the runtime poller
+	skip Skip
+
+	mu   sync.Mutex
+	dirs map[int]string // watch descriptor -> directory
+
+	// Changes receives the path of every created, changed or removed file
+	// or directory. It must be drained until it is closed, which happens
+	// once the watcher is closed.
+	Changes chan string
+}
+
+// New creates a watcher; skip may be nil.
+func New(skip Skip) (*Watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize inotify (%w)", err)
+	}
+	if skip == nil {
+		skip = func(string) bool { return false }
+	}
+	w := &Watcher{
+		fd: fd,
+		// as the fd is non-blocking, reads go through the runtime poller and
+		// closing the file interrupts a pending read
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		skip:    skip,
+		dirs:    map[int]string{},
+		Changes: make(chan string, 64),
+	}
+	go w.read()
+	return w, nil
+}
+
+// AddTree watches root and every directory below it. A root that is a
+// symlink is followed, and changes are reported below where it points.
+func (w *Watcher) AddTree(root string) error {
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			// the tree may change while being walked
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != root && w.skip(p) {
+			return filepath.SkipDir
+		}
+		return w.add(p)
+	})
+}
+
+func (w *Watcher) add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	wd, err := unix.InotifyAddWatch(w.fd, dir, events|unix.IN_ONLYDIR)
+	if err != nil {
+		return fmt.Errorf("unable to watch '%s' (%w)", dir, err)
+	}
+	w.dirs[wd] = dir
+	return nil
+}
+
+// Close stops watching.
+func (w *Watcher) Close() error {
+	return w.file.Close()
+}
+
+func (w *Watcher) read() {
+	defer close(w.Changes)
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if errors.Is(err, os.ErrClosed) || errors.Is(err, fs.ErrClosed) {
+				return
+			}
+			continue
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(event.Len)]
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+
+			w.mu.Lock()
+			dir, ok := w.dirs[int(event.Wd)]
+			if event.Mask&unix.IN_IGNORED != 0 {
+				delete(w.dirs, int(event.Wd))
+			}
+			w.mu.Unlock()
+			if !ok {
+				continue
+			}
+
+			name := string(nameBytes)
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+			p := dir
+			if name != "" {
+				p = filepath.Join(dir, name)
+			}
+
+			if event.Mask&unix.IN_ISDIR != 0 && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 && !w.skip(p) {
+				// a directory could have been moved here with contents, so add
+				// the whole tree; failures are fine, it may be gone already
+				_ = w.AddTree(p)
+			}
+			w.Changes <- p
+		}
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package watch
+
+// Watcher watches directory trees; it is only implemented on Linux.
+type Watcher struct {
+	Changes chan string
+}
+
+// New returns ErrUnsupported.
+func New(skip Skip) (*Watcher, error) {
+	return nil, ErrUnsupported
+}
+
+// AddTree returns ErrUnsupported.
+func (w *Watcher) AddTree(root string) error {
+	return ErrUnsupported
+}
+
+// Close does nothing.
+func (w *Watcher) Close() error {
+	return nil
+}